@@ -0,0 +1,140 @@
+package jsonfs
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// MarshalCanonical writes v as canonical JSON as defined by the JSON
+// Canonicalization Scheme (JCS, RFC 8785). The output is the same for the
+// same data no matter how it was created, so it can be hashed or signed.
+// This is the same as MarshalJSON(w, v, WithCanonical()).
+func MarshalCanonical(w io.Writer, v FileOrDir) error {
+	return MarshalJSON(w, v, WithCanonical())
+}
+
+// WithCanonical causes output to be canonical JSON as defined by RFC 8785:
+// object keys are sorted by their UTF-16 code units, numbers are written the
+// way ECMAScript does and strings only have the escaping JSON requires. Numbers
+// are converted to float64 as required, so FTBigInt and FTDecimal values can
+// lose precision and values too large for a float64 are an error.
+// This overrides WithHTMLSafe().
+func WithCanonical() EncodeOption {
+	return func(o *encodeOptions) {
+		o.canonical = true
+	}
+}
+
+// sortUTF16 sorts names by their UTF-16 code units, as RFC 8785 requires.
+// names is not changed, a sorted copy is returned.
+func sortUTF16(names []string) []string {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Slice(sorted, func(i, j int) bool { return lessUTF16(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// lessUTF16 reports if a sorts before b when they are compared by UTF-16 code units.
+func lessUTF16(a, b string) bool {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			// Runes outside the BMP start with a surrogate, which sorts before
+			// U+E000 to U+FFFF. If both are outside the BMP, rune order is the same
+			// as code unit order.
+			fa, fb := firstUnit(ra), firstUnit(rb)
+			if fa != fb {
+				return fa < fb
+			}
+			return ra < rb
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return len(a) < len(b)
+}
+
+// firstUnit returns the first UTF-16 code unit of r.
+func firstUnit(r rune) rune {
+	if r >= 0x10000 {
+		r1, _ := utf16.EncodeRune(r)
+		return r1
+	}
+	return r
+}
+
+// writeCanonicalNumber writes the number f holds as ECMAScript's
+// Number.prototype.toString() would.
+func writeCanonicalNumber(w io.Writer, f File) error {
+	fl, err := strconv.ParseFloat(ByteSlice2String(f.value), 64)
+	if err != nil || math.IsInf(fl, 0) || math.IsNaN(fl) {
+		return fmt.Errorf("number %s cannot be represented in canonical JSON", f.value)
+	}
+	var buff [32]byte
+	return WriteOut(w, appendES6Number(buff[:0], fl, 64))
+}
+
+// appendES6Number appends f to b formatted as ECMAScript does, with the
+// shortest digits that round trip to a float of bitSize bits. f must be finite.
+func appendES6Number(b []byte, f float64, bitSize int) []byte {
+	if f == 0 { // Also -0.
+		return append(b, '0')
+	}
+	if f < 0 {
+		b = append(b, '-')
+		f = -f
+	}
+
+	// Get the shortest digits that round trip and the exponent, such as 1.2345e+06.
+	var buff [32]byte
+	e := strconv.AppendFloat(buff[:0], f, 'e', -1, bitSize)
+	i := 0
+	for e[i] != 'e' {
+		i++
+	}
+	exp, _ := strconv.Atoi(string(e[i+1:]))
+	digits := make([]byte, 0, i)
+	for _, c := range e[:i] {
+		if c != '.' {
+			digits = append(digits, c)
+		}
+	}
+
+	// n is where the decimal point goes in digits, as in the ECMAScript spec.
+	n := exp + 1
+	k := len(digits)
+	switch {
+	case k <= n && n <= 21:
+		b = append(b, digits...)
+		for ; k < n; k++ {
+			b = append(b, '0')
+		}
+	case 0 < n && n <= 21:
+		b = append(b, digits[:n]...)
+		b = append(b, '.')
+		b = append(b, digits[n:]...)
+	case -6 < n && n <= 0:
+		b = append(b, '0', '.')
+		for ; n < 0; n++ {
+			b = append(b, '0')
+		}
+		b = append(b, digits...)
+	default:
+		b = append(b, digits[0])
+		if k > 1 {
+			b = append(b, '.')
+			b = append(b, digits[1:]...)
+		}
+		b = append(b, 'e')
+		if exp >= 0 {
+			b = append(b, '+')
+		}
+		b = strconv.AppendInt(b, int64(exp), 10)
+	}
+	return b
+}
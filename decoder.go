@@ -0,0 +1,506 @@
+package jsonfs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// excerptLen is how many bytes on each side of an error are put in a SyntaxError.Excerpt.
+	excerptLen = 16
+	// recentLen is how many of the last bytes read we keep. It is larger than excerptLen
+	// because unreading leaves the unread bytes in the slots of the oldest bytes.
+	recentLen = excerptLen * 2
+)
+
+// decoder wraps the *bufio.Reader we are decoding from and tracks where
+// we are in the input, so that a SyntaxError can say where a problem is.
+// It has the same read methods as a *bufio.Reader, which are the only ones
+// the parser uses.
+type decoder struct {
+	b *bufio.Reader
+
+	// offset is the number of bytes that have been consumed.
+	offset int64
+	// line is the current line number, starting at 1.
+	line int
+	// lineStart is the offset of the first byte on the current line.
+	lineStart int64
+	// prevLineStart is lineStart before the last newline, so that a newline can be unread.
+	prevLineStart int64
+	// lastSize is the size of the last rune read by ReadRune(), -1 if UnreadRune() cannot be called.
+	lastSize int
+	// recent holds the last bytes read, indexed by offset % recentLen.
+	recent [recentLen]byte
+	// recentStart is the offset of the first byte that can be in recent.
+	recentStart int64
+
+	// path holds the object keys and array indexes that lead to the value being decoded.
+	path []string
+
+	// readErr is set if the underlying io.Reader returned an error other than io.EOF.
+	readErr error
+
+	// opts are the options passed to the Unmarshal function.
+	opts decodeOptions
+	// byteLimit is the offset at which Limits.MaxBytes is exceeded.
+	byteLimit int64
+
+	// live holds the indexes into opts.paths of the patterns that the objects
+	// and arrays being decoded may match, see pathFilter.
+	live []int
+	// skipBuff and skipStack are reused by skipValue(). skipBuff is also used by
+	// decodeNumber() when the input is in memory.
+	skipBuff  []byte
+	skipStack []bool
+
+	// input is all of the input when it is in memory, with offset inputStart
+	// at input[0]. Values are not copied out of it unless WithCopy() was used.
+	input      []byte
+	inputStart int64
+	// lazy is set when parsing a Directory from WithLazy(), where objects and
+	// arrays are not decoded, see lazyChild(). input must be set.
+	lazy bool
+
+	// capturing is set when every byte that is read is added to capture, see
+	// nextJob().
+	capturing bool
+	capture   []byte
+	// replay is what b reads from when WithSkipErrors() is used with a stream,
+	// so that skipRecord() can put input back.
+	replay *replayReader
+}
+
+var decoderPool = sync.Pool{
+	New: func() any {
+		return &decoder{}
+	},
+}
+
+// newDecoder gets a decoder from the decoderPool that reads from b. It
+// should be returned to the pool when decoding is done.
+func newDecoder(b *bufio.Reader, opts decodeOptions) *decoder {
+	d := decoderPool.Get().(*decoder)
+	d.reset(b)
+	d.opts = opts
+	return d
+}
+
+// close returns the decoder to the decoderPool.
+func (d *decoder) close() {
+	d.b = nil
+	d.opts = decodeOptions{}
+	d.input = nil
+	d.capture = nil
+	d.replay = nil
+	decoderPool.Put(d)
+}
+
+// reset resets the decoder to read from b.
+func (d *decoder) reset(b *bufio.Reader) {
+	d.b = b
+	d.offset = 0
+	d.line = 1
+	d.lineStart = 0
+	d.prevLineStart = 0
+	d.recentStart = 0
+	d.lastSize = -1
+	d.path = d.path[:0]
+	d.readErr = nil
+	d.byteLimit = math.MaxInt64
+	d.input = nil
+	d.inputStart = 0
+	d.lazy = false
+	d.capturing = false
+	d.capture = nil
+	d.replay = nil
+}
+
+// seek makes d act as if it had read up to offset, where the line that offset
+// is on started at lineStart. before is the input just before offset, which is
+// used for the excerpts in errors.
+func (d *decoder) seek(offset int64, line int, lineStart int64, before []byte) {
+	d.offset, d.line, d.lineStart, d.prevLineStart = offset, line, lineStart, lineStart
+	if len(before) > recentLen {
+		before = before[len(before)-recentLen:]
+	}
+	d.recentStart = offset - int64(len(before))
+	for i, c := range before {
+		d.recent[(d.recentStart+int64(i))%recentLen] = c
+	}
+}
+
+// recentBytes returns a copy of the last bytes read, up to recentLen of them.
+func (d *decoder) recentBytes() []byte {
+	start := d.offset - recentLen
+	if start < d.recentStart {
+		start = d.recentStart
+	}
+	b := make([]byte, 0, d.offset-start)
+	for i := start; i < d.offset; i++ {
+		b = append(b, d.recent[i%recentLen])
+	}
+	return b
+}
+
+// startValue skips any space before a top level value and starts applying
+// Limits.MaxBytes to it.
+func (d *decoder) startValue() {
+	d.byteLimit = math.MaxInt64
+	skipSpace(d)
+	if d.opts.limits.MaxBytes > 0 {
+		d.byteLimit = d.offset + d.opts.limits.MaxBytes
+	}
+}
+
+// overLimit returns a *LimitError if more than Limits.MaxBytes have been read.
+// This is recorded as a read error, so decoding cannot continue after it.
+func (d *decoder) overLimit() error {
+	if d.offset <= d.byteLimit {
+		return nil
+	}
+	if d.readErr == nil {
+		d.readErr = d.limitError("MaxBytes", d.opts.limits.MaxBytes)
+	}
+	return d.readErr
+}
+
+// consumed records that c was read.
+func (d *decoder) consumed(c byte) {
+	if d.capturing {
+		d.capture = append(d.capture, c)
+	}
+	d.recent[d.offset%recentLen] = c
+	d.offset++
+	if c == '\n' {
+		d.line++
+		d.prevLineStart = d.lineStart
+		d.lineStart = d.offset
+	}
+}
+
+// unconsumed records that the last byte read was put back.
+func (d *decoder) unconsumed() {
+	if d.capturing {
+		d.capture = d.capture[:len(d.capture)-1]
+	}
+	d.offset--
+	if d.recent[d.offset%recentLen] == '\n' {
+		d.line--
+		d.lineStart = d.prevLineStart
+	}
+}
+
+// setErr records err if it came from the underlying io.Reader. If an error
+// was recorded, it is returned instead of io.EOF.
+func (d *decoder) setErr(err error) error {
+	switch {
+	case err == nil:
+	case err == io.EOF && d.readErr != nil:
+		return d.readErr
+	case err != io.EOF && d.readErr == nil:
+		d.readErr = err
+	}
+	return err
+}
+
+// ReadRune implements bufio.Reader.ReadRune().
+func (d *decoder) ReadRune() (rune, int, error) {
+	r, size, err := d.b.ReadRune()
+	if err != nil {
+		d.lastSize = -1
+		return r, size, d.setErr(err)
+	}
+	d.lastSize = size
+	if size == 1 {
+		d.consumed(byte(r))
+	} else {
+		var buff [utf8.UTFMax]byte
+		utf8.EncodeRune(buff[:], r)
+		for i := 0; i < size; i++ {
+			d.consumed(buff[i])
+		}
+	}
+	if err := d.overLimit(); err != nil {
+		d.lastSize = -1
+		return r, size, err
+	}
+	return r, size, nil
+}
+
+// UnreadRune implements bufio.Reader.UnreadRune().
+func (d *decoder) UnreadRune() error {
+	if d.lastSize < 0 {
+		return bufio.ErrInvalidUnreadRune
+	}
+	if err := d.b.UnreadRune(); err != nil {
+		return err
+	}
+	for i := 0; i < d.lastSize; i++ {
+		d.unconsumed()
+	}
+	d.lastSize = -1
+	return nil
+}
+
+// ReadByte implements bufio.Reader.ReadByte().
+func (d *decoder) ReadByte() (byte, error) {
+	d.lastSize = -1
+	c, err := d.b.ReadByte()
+	if err != nil {
+		return c, d.setErr(err)
+	}
+	d.consumed(c)
+	return c, d.overLimit()
+}
+
+// UnreadByte implements bufio.Reader.UnreadByte().
+func (d *decoder) UnreadByte() error {
+	d.lastSize = -1
+	if err := d.b.UnreadByte(); err != nil {
+		return err
+	}
+	d.unconsumed()
+	return nil
+}
+
+// inMemory reports if values can be taken from d.input without copying them.
+func (d *decoder) inMemory() bool {
+	return d.input != nil && !d.opts.copy
+}
+
+// inputBytes reads the next n bytes and returns them from d.input without
+// copying them. d.inMemory() must be true.
+func (d *decoder) inputBytes(n int) ([]byte, error) {
+	d.lastSize = -1
+	start := d.offset - d.inputStart
+	n, err := d.b.Discard(n)
+	end := start + int64(n)
+	d.consumedBytes(d.input[start:end])
+	if err := d.overLimit(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, d.setErr(err)
+	}
+	return d.input[start:end:end], nil
+}
+
+// buffered returns the bytes that are buffered, reading more if there are none.
+// This lets us scan many bytes at a time. The slice is only valid until the
+// next read.
+func (d *decoder) buffered() ([]byte, error) {
+	n := d.b.Buffered()
+	if n == 0 {
+		if _, err := d.Peek(1); err != nil {
+			return nil, err
+		}
+		n = d.b.Buffered()
+	}
+	return d.b.Peek(n)
+}
+
+// discard reads past the next n bytes, which must be buffered.
+func (d *decoder) discard(n int) error {
+	d.lastSize = -1
+	x, _ := d.b.Peek(n)
+	d.consumedBytes(x)
+	d.b.Discard(n)
+	return d.overLimit()
+}
+
+// peekRune returns the next rune without reading it. It returns
+// utf8.RuneError if there is not a valid rune.
+func (d *decoder) peekRune() rune {
+	x, _ := d.b.Peek(utf8.UTFMax) // Returns what it can at the end of the input.
+	r, _ := utf8.DecodeRune(x)
+	return r
+}
+
+// peekBuffered returns up to the next n bytes without reading more than is
+// buffered, so it does not wait on an io.Reader that is waiting for input.
+func (d *decoder) peekBuffered(n int) []byte {
+	if b := d.b.Buffered(); b < n {
+		n = b
+	}
+	x, _ := d.b.Peek(n)
+	return x
+}
+
+// Peek implements bufio.Reader.Peek().
+func (d *decoder) Peek(n int) ([]byte, error) {
+	b, err := d.b.Peek(n)
+	return b, d.setErr(err)
+}
+
+// readBytes is like bufio.Reader.ReadBytes(), but appends to buff. If max > 0,
+// a *LimitError naming limit is returned once buff[start:], not counting delim,
+// is longer than max. This keeps us from reading an unbounded amount into memory.
+func (d *decoder) readBytes(buff []byte, start int, delim byte, limit string, max int) ([]byte, error) {
+	d.lastSize = -1
+	for {
+		frag, err := d.b.ReadSlice(delim)
+		d.consumedBytes(frag)
+		buff = append(buff, frag...)
+		if err := d.overLimit(); err != nil {
+			return buff, err
+		}
+		if max > 0 {
+			n := len(buff) - start
+			if err == nil {
+				n--
+			}
+			if n > max {
+				return buff, d.limitError(limit, int64(max))
+			}
+		}
+		if err != bufio.ErrBufferFull {
+			return buff, d.setErr(err)
+		}
+	}
+}
+
+// Read implements io.Reader.
+func (d *decoder) Read(p []byte) (int, error) {
+	d.lastSize = -1
+	n, err := d.b.Read(p)
+	d.consumedBytes(p[:n])
+	if lErr := d.overLimit(); lErr != nil {
+		return n, lErr
+	}
+	return n, d.setErr(err)
+}
+
+// consumedBytes records that all of b was read.
+func (d *decoder) consumedBytes(b []byte) {
+	if d.capturing {
+		d.capture = append(d.capture, b...)
+	}
+	if i := bytes.LastIndexByte(b, '\n'); i != -1 {
+		d.line += bytes.Count(b, []byte{'\n'})
+		d.prevLineStart = d.lineStart
+		d.lineStart = d.offset + int64(i) + 1
+	}
+	if len(b) > recentLen {
+		d.offset += int64(len(b) - recentLen)
+		b = b[len(b)-recentLen:]
+	}
+	for _, c := range b {
+		d.recent[d.offset%recentLen] = c
+		d.offset++
+	}
+}
+
+// pos returns the offset, line and column of the next byte to be read.
+func (d *decoder) pos() (offset int64, line, column int) {
+	return d.offset, d.line, int(d.offset-d.lineStart) + 1
+}
+
+// pushPath adds name to the path of the value being decoded.
+func (d *decoder) pushPath(name string) {
+	d.path = append(d.path, name)
+}
+
+// popPath removes the last name added with pushPath().
+func (d *decoder) popPath() {
+	d.path = d.path[:len(d.path)-1]
+}
+
+// pathString returns the current path as a JSON Pointer (RFC 6901).
+func (d *decoder) pathString() string {
+	if len(d.path) == 0 {
+		return ""
+	}
+	sb := strings.Builder{}
+	for _, p := range d.path {
+		sb.WriteByte('/')
+		if strings.ContainsAny(p, "~/") {
+			p = strings.ReplaceAll(p, "~", "~0")
+			p = strings.ReplaceAll(p, "/", "~1")
+		}
+		sb.WriteString(p)
+	}
+	return sb.String()
+}
+
+// excerpt returns the input around our current position.
+func (d *decoder) excerpt() string {
+	start := d.offset - excerptLen
+	if start < d.recentStart {
+		start = d.recentStart
+	}
+	buff := make([]byte, 0, excerptLen*2)
+	for i := start; i < d.offset; i++ {
+		buff = append(buff, d.recent[i%recentLen])
+	}
+	buff = append(buff, d.peekBuffered(excerptLen)...)
+	return string(buff)
+}
+
+// limitError returns a *LimitError for limit at our current position.
+func (d *decoder) limitError(limit string, max int64) error {
+	offset, line, column := d.pos()
+	return &LimitError{
+		Limit:  limit,
+		Max:    max,
+		Offset: offset,
+		Line:   line,
+		Column: column,
+		Path:   d.pathString(),
+	}
+}
+
+// syntaxErrorBack is like syntaxError(), but for an error found back bytes
+// before our current position, on the same line. err must not be one that
+// syntaxError() returns as is.
+func (d *decoder) syntaxErrorBack(err error, back int64) error {
+	if d.readErr != nil {
+		return d.readErr
+	}
+	sErr := d.syntaxError(err).(*SyntaxError)
+	sErr.Offset -= back
+	sErr.Column -= int(back)
+	return sErr
+}
+
+// syntaxError converts an error found while decoding into a *SyntaxError
+// that records our current position. Errors from the underlying io.Reader,
+// *CanceledError and *LimitError are returned as is.
+func (d *decoder) syntaxError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if d.readErr != nil {
+		return d.readErr
+	}
+
+	var cErr *CanceledError
+	var sErr *SyntaxError
+	var lErr *LimitError
+	switch {
+	case errors.As(err, &cErr), errors.As(err, &sErr), errors.As(err, &lErr):
+		return err
+	}
+
+	msg := err.Error()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		msg = "unexpected end of JSON input"
+		err = io.ErrUnexpectedEOF
+	}
+	offset, line, column := d.pos()
+	return &SyntaxError{
+		Msg:     msg,
+		Offset:  offset,
+		Line:    line,
+		Column:  column,
+		Path:    d.pathString(),
+		Excerpt: d.excerpt(),
+		Err:     err,
+	}
+}
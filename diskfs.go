@@ -121,7 +121,7 @@ func (f DiskFS) Directory(name string) (Directory, error) {
 				if err != nil {
 					return err
 				}
-				subDir.objs[fileName] = Object{Type: OTDir, Dir: dir}
+				subDir.setObj(fileName, Object{Type: OTDir, Dir: dir})
 				return nil
 			}
 			b, err := f.fs.ReadFile(p)
@@ -133,7 +133,7 @@ func (f DiskFS) Directory(name string) (Directory, error) {
 			if err != nil {
 				return err
 			}
-			subDir.objs[fileName] = Object{Type: OTFile, File: file}
+			subDir.setObj(fileName, Object{Type: OTFile, File: file})
 			return nil
 		},
 	)
@@ -0,0 +1,121 @@
+package jsonfs
+
+import (
+	"context"
+	"fmt"
+)
+
+// SyntaxError is returned when the input is not valid JSON. Use errors.As()
+// to get at the details.
+type SyntaxError struct {
+	// Msg describes the problem.
+	Msg string
+	// Offset is the number of bytes read from the input before the problem was found.
+	Offset int64
+	// Line is the line number of Offset, starting at 1.
+	Line int
+	// Column is the byte position of Offset in Line, starting at 1.
+	Column int
+	// Path is a JSON Pointer (RFC 6901) to the value being decoded, such as
+	// /items/42/price. It is empty if the problem is in the top level value.
+	Path string
+	// Excerpt holds a few bytes of input on either side of Offset.
+	Excerpt string
+	// Err is the underlying error, if there was one.
+	Err error
+}
+
+// Error implements error.Error().
+func (e *SyntaxError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("syntax error at line %d, column %d (offset %d) in %s: %s: near %q", e.Line, e.Column, e.Offset, path, e.Msg, e.Excerpt)
+}
+
+// Unwrap implements errors.Unwrap().
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// LimitError is returned when the input exceeds one of the Limits passed with
+// WithLimits().
+type LimitError struct {
+	// Limit is the name of the Limits field that was exceeded, such as MaxDepth.
+	Limit string
+	// Max is the value of the limit.
+	Max int64
+	// Offset is the number of bytes read from the input when the limit was exceeded.
+	Offset int64
+	// Line is the line number of Offset, starting at 1.
+	Line int
+	// Column is the byte position of Offset in Line, starting at 1.
+	Column int
+	// Path is a JSON Pointer (RFC 6901) to the value being decoded.
+	Path string
+}
+
+// Error implements error.Error().
+func (e *LimitError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s of %d exceeded at line %d, column %d (offset %d) in %s", e.Limit, e.Max, e.Line, e.Column, e.Offset, path)
+}
+
+// RecordError is the Stream.Err for a value that was skipped because of an
+// error when WithSkipErrors() is used. The stream goes on after it.
+type RecordError struct {
+	// Offset is the number of bytes read from the input before the value.
+	Offset int64
+	// Line is the line number of Offset, starting at 1.
+	Line int
+	// Raw is the input that was skipped, starting at Offset. This does not
+	// include the newline it was skipped up to.
+	Raw []byte
+	// Err is the error the value had.
+	Err error
+}
+
+// Error implements error.Error().
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("skipped value at line %d (offset %d): %s", e.Line, e.Offset, e.Err)
+}
+
+// Unwrap implements errors.Unwrap().
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// CanceledError is returned when decoding stops because the Context passed
+// was canceled or its deadline passed. It wraps the Context's error, so
+// errors.Is(err, context.Canceled) and errors.Is(err, context.DeadlineExceeded)
+// work as expected.
+type CanceledError struct {
+	// Err is the error returned by Context.Err().
+	Err error
+}
+
+// Error implements error.Error().
+func (e *CanceledError) Error() string {
+	return "unmarshal stopped: " + e.Err.Error()
+}
+
+// Unwrap implements errors.Unwrap().
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
+// checkCtx returns a *CanceledError if ctx is done. This is called for every
+// value we decode, so it avoids the lock that ctx.Err() may take unless the
+// Context is actually done.
+func checkCtx(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return &CanceledError{Err: ctx.Err()}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,206 @@
+package jsonfs
+
+import (
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// unescape decodes the JSON escape sequences in the string content b (without
+// the surrounding quotes). Because a decoded value is never longer than its
+// escaped form, the decoding happens in place and the returned slice shares
+// b's underlying array. Lone surrogates are replaced with utf8.RuneError,
+// which matches what encoding/json does. If relaxed is set, the JSON5 escape
+// \' is also allowed.
+func unescape(b []byte, relaxed bool) ([]byte, error) {
+	// Fast path, nothing to decode.
+	i := 0
+	for ; i < len(b); i++ {
+		if b[i] == backslash {
+			break
+		}
+		if b[i] < 0x20 {
+			return nil, fmt.Errorf("invalid control character %q in string", b[i])
+		}
+	}
+	if i == len(b) {
+		return b, nil
+	}
+
+	w := i
+	for i < len(b) {
+		c := b[i]
+		switch {
+		case c < 0x20:
+			return nil, fmt.Errorf("invalid control character %q in string", c)
+		case c != backslash:
+			b[w] = c
+			w++
+			i++
+			continue
+		}
+
+		if i+1 >= len(b) {
+			return nil, fmt.Errorf("string ends with an incomplete escape sequence")
+		}
+		switch b[i+1] {
+		case '"', '\\', '/':
+			b[w] = b[i+1]
+		case 'b':
+			b[w] = '\b'
+		case 'f':
+			b[w] = '\f'
+		case 'n':
+			b[w] = '\n'
+		case 'r':
+			b[w] = '\r'
+		case 't':
+			b[w] = '\t'
+		case '\'':
+			if !relaxed {
+				return nil, fmt.Errorf("invalid escape sequence %q in string", b[i:i+2])
+			}
+			b[w] = '\''
+		case 'u':
+			r, ok := getU4(b[i:])
+			if !ok {
+				end := i + 6
+				if end > len(b) {
+					end = len(b)
+				}
+				return nil, fmt.Errorf("invalid unicode escape sequence %q", b[i:end])
+			}
+			i += 6
+			if utf16.IsSurrogate(r) {
+				r2, ok := getU4(b[i:])
+				if dec := utf16.DecodeRune(r, r2); ok && dec != utf8.RuneError {
+					r = dec
+					i += 6
+				} else {
+					r = utf8.RuneError
+				}
+			}
+			w += utf8.EncodeRune(b[w:], r)
+			continue
+		default:
+			return nil, fmt.Errorf("invalid escape sequence %q in string", b[i:i+2])
+		}
+		w++
+		i += 2
+	}
+	return b[:w], nil
+}
+
+// getU4 decodes a \uXXXX escape at the start of b.
+func getU4(b []byte) (rune, bool) {
+	if len(b) < 6 || b[0] != backslash || b[1] != 'u' {
+		return -1, false
+	}
+	var r rune
+	for _, c := range b[2:6] {
+		switch {
+		case '0' <= c && c <= '9':
+			c = c - '0'
+		case 'a' <= c && c <= 'f':
+			c = c - 'a' + 10
+		case 'A' <= c && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return -1, false
+		}
+		r = r*16 + rune(c)
+	}
+	return r, true
+}
+
+const hex = "0123456789abcdef"
+
+// simpleEscapes holds the short escape sequence for the bytes that have one.
+var simpleEscapes = [256]string{
+	'"':  `\"`,
+	'\\': `\\`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\t': `\t`,
+}
+
+// writeString writes s to w as a quoted JSON string, escaping as needed. If
+// htmlSafe is set, <, >, & and the line/paragraph separators U+2028 and
+// U+2029 are also escaped so the output can be embedded in HTML <script> tags.
+// Invalid UTF-8 is written as \ufffd.
+func writeString(w io.Writer, s []byte, htmlSafe bool) error {
+	if err := WriteOut(w, doubleQuote); err != nil {
+		return err
+	}
+
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && (!htmlSafe || (c != '<' && c != '>' && c != '&')) {
+				i++
+				continue
+			}
+			if err := WriteOut(w, s[start:i]); err != nil {
+				return err
+			}
+			if esc := simpleEscapes[c]; esc != "" {
+				if err := WriteOut(w, esc); err != nil {
+					return err
+				}
+			} else {
+				if err := writeU4(w, rune(c)); err != nil {
+					return err
+				}
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			if err := WriteOut(w, s[start:i]); err != nil {
+				return err
+			}
+			if err := WriteOut(w, `\ufffd`); err != nil {
+				return err
+			}
+			i += size
+			start = i
+			continue
+		}
+		if htmlSafe && (r == '\u2028' || r == '\u2029') {
+			if err := WriteOut(w, s[start:i]); err != nil {
+				return err
+			}
+			if err := writeU4(w, r); err != nil {
+				return err
+			}
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	if err := WriteOut(w, s[start:]); err != nil {
+		return err
+	}
+	return WriteOut(w, doubleQuote)
+}
+
+// writeU4 writes r, which must be in the basic multilingual plane, as \uXXXX.
+func writeU4(w io.Writer, r rune) error {
+	if err := WriteOut(w, `\u`); err != nil {
+		return err
+	}
+	for shift := 12; shift >= 0; shift -= 4 {
+		if err := WriteOut(w, rune(hex[(r>>shift)&0xF])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
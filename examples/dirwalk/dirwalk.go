@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/fs"
 	"log"
@@ -36,4 +37,29 @@ func main() {
 		}
 		return nil
 	})
+
+	// The same output, but streamed from the JSON without building a Directory.
+	// Values come in the order they are in the JSON instead of name order.
+	buff := &bytes.Buffer{}
+	if err := jsonfs.MarshalJSON(buff, dir); err != nil {
+		log.Fatal(err)
+	}
+
+	printDir := func(p string) error {
+		if p != "." {
+			fmt.Printf("%s/\n", p)
+		}
+		return nil
+	}
+	err := jsonfs.Walk(buff, jsonfs.HandlerFuncs{
+		ObjectStart: printDir,
+		ArrayStart:  printDir,
+		Value: func(p string, f jsonfs.File) error {
+			fmt.Printf("%s:%s:%v\n", p, f.JSONType(), f.Any())
+			return nil
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -13,11 +13,13 @@ func _() {
 	_ = x[FTInt-2]
 	_ = x[FTFloat-3]
 	_ = x[FTString-4]
+	_ = x[FTBigInt-5]
+	_ = x[FTDecimal-6]
 }
 
-const _FileType_name = "FTNullFTBoolFTIntFTFloatFTString"
+const _FileType_name = "FTNullFTBoolFTIntFTFloatFTStringFTBigIntFTDecimal"
 
-var _FileType_index = [...]uint8{0, 6, 12, 17, 24, 32}
+var _FileType_index = [...]uint8{0, 6, 12, 17, 24, 32, 40, 49}
 
 func (i FileType) String() string {
 	if i >= FileType(len(_FileType_index)-1) {
@@ -0,0 +1,213 @@
+package jsonfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WithPaths causes only the values whose paths match one of patterns to be
+// decoded, along with the objects and arrays that hold them. Everything else is
+// read and checked, but skipped without being kept in memory, which makes
+// exploring large inputs much cheaper. A pattern is a path like those used with
+// Directory.GetFile(), where a "*" part matches any key or array index and a
+// "#" part matches any array index, such as "users/*/email" or "items/#/price".
+// If a value matches, all of it is kept. An empty pattern matches everything.
+//
+// Objects and arrays that lead to a pattern but hold nothing that matches are
+// not kept. The elements kept from an array are numbered from 0, so the result
+// is still an array. Repeated keys are only checked among the kept values and
+// Limits.MaxKeys and Limits.MaxArrayLen are not checked inside skipped values.
+// Patterns are matched from the value being decoded, so with
+// UnmarshalArrayStream() they are matched from each element of the array.
+// This is only used when decoding to a Directory.
+func WithPaths(patterns ...string) DecodeOption {
+	return func(o *decodeOptions) {
+		o.paths = make([][]string, 0, len(patterns))
+		for _, p := range patterns {
+			p = strings.Trim(p, "/")
+			if p == "" || p == "." {
+				o.paths = append(o.paths, nil)
+				continue
+			}
+			o.paths = append(o.paths, strings.Split(p, "/"))
+		}
+	}
+}
+
+// pathFilter is how a parser filters the values of an object or array with
+// the patterns from WithPaths().
+type pathFilter struct {
+	// on is set if the values are filtered.
+	on bool
+	// base is the length of decoder.path for the value being decoded, which is
+	// where the patterns are matched from.
+	base int
+	// start and end are the range in decoder.live of the patterns that values
+	// may match.
+	start, end int
+}
+
+// rootFilter returns the pathFilter for the value that is about to be decoded.
+func (d *decoder) rootFilter() pathFilter {
+	if len(d.opts.paths) == 0 {
+		return pathFilter{}
+	}
+	d.live = d.live[:0]
+	for i, p := range d.opts.paths {
+		if len(p) == 0 {
+			return pathFilter{}
+		}
+		d.live = append(d.live, i)
+	}
+	return pathFilter{on: true, base: len(d.path), start: 0, end: len(d.live)}
+}
+
+// filterChild decides if the value that is next, whose name was just added to
+// d.path, is kept. next is the kind of value and array is set if it is in an
+// array. If only part of the value is kept, the returned pathFilter is on
+// and the patterns it may match are at the end of d.live. They must be
+// removed with dropFilter() when the value has been decoded.
+func (d *decoder) filterChild(f pathFilter, next next, array bool) (bool, pathFilter) {
+	level := len(d.path) - 1 - f.base
+	name := d.path[len(d.path)-1]
+
+	child := pathFilter{on: true, base: f.base, start: len(d.live)}
+	for _, i := range d.live[f.start:f.end] {
+		p := d.opts.paths[i]
+		switch seg := p[level]; {
+		case seg == name, seg == "*", seg == "#" && array:
+		default:
+			continue
+		}
+		if len(p) == level+1 {
+			d.live = d.live[:child.start]
+			return true, pathFilter{}
+		}
+		if next == msgNext || next == arrayNext {
+			d.live = append(d.live, i)
+		}
+	}
+	child.end = len(d.live)
+	return child.end > child.start, child
+}
+
+// dropFilter removes the patterns of a pathFilter from filterChild().
+func (d *decoder) dropFilter(f pathFilter) {
+	if f.on {
+		d.live = d.live[:f.start]
+	}
+}
+
+// skipValue reads and checks the next value in b, but does not keep it.
+// Buffers in b are reused, so this does not allocate.
+func skipValue(b *decoder) error {
+	// stack holds if each object or array we are in is an array.
+	stack := b.skipStack[:0]
+	defer func() { b.skipStack = stack[:0] }()
+
+	for {
+		next, err := valueCheck(b)
+		if err != nil {
+			return err
+		}
+		switch next {
+		case msgNext, arrayNext:
+			if max := b.opts.limits.MaxDepth; max > 0 && len(b.path)+len(stack) >= max {
+				return b.limitError("MaxDepth", int64(max))
+			}
+			b.ReadByte() // The open brace or bracket, which valueCheck() found.
+			stack = append(stack, next == arrayNext)
+
+			close := byte(closeBrace)
+			if next == arrayNext {
+				close = closeBracket
+			}
+			empty, err := closeNext(b, close)
+			if err != nil {
+				return err
+			}
+			// An empty object or array is closed below.
+			if !empty {
+				if next == msgNext {
+					if err := skipKey(b); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		case stringNext:
+			err = skipString(b)
+		case trueNext, falseNext, nullNext:
+			var n int
+			if n, err = literal(b, next); err == nil {
+				err = b.discard(n)
+			}
+		case numNext:
+			var buff []byte
+			if buff, _, err = appendNumber(b.skipBuff[:0], b); err == nil {
+				b.skipBuff = buff
+			}
+		default:
+			err = fmt.Errorf("unexpected value type, got %v", next)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Read the commas and closes up to the next value.
+		for more := false; !more; {
+			if len(stack) == 0 {
+				return nil
+			}
+			array := stack[len(stack)-1]
+			close := byte(closeBrace)
+			if array {
+				close = closeBracket
+			}
+
+			member, err := nextMember(b, close)
+			switch {
+			case err != nil:
+				return err
+			case !member:
+				b.ReadByte() // The close, which nextMember() found.
+				stack = stack[:len(stack)-1]
+			case array:
+				more = true
+			default:
+				if err := skipKey(b); err != nil {
+					return err
+				}
+				more = true
+			}
+		}
+	}
+}
+
+// skipKey reads and checks an object key and the colon after it.
+func skipKey(b *decoder) error {
+	ident, err := keyStart(b)
+	if err != nil {
+		return err
+	}
+	if ident {
+		_, err = getIdentifier(b)
+	} else {
+		err = skipString(b)
+	}
+	if err != nil {
+		return err
+	}
+	return keyEnd(b)
+}
+
+// skipString reads and checks a string.
+func skipString(b *decoder) error {
+	s, err := appendRawString(b.skipBuff[:0], b, true)
+	if err != nil {
+		return err
+	}
+	b.skipBuff = s
+	_, err = unescape(s, b.opts.relaxed)
+	return err
+}
@@ -0,0 +1,164 @@
+package jsonfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	const text = `{
+		"user": {
+			"bob": {"email": "bob@example.com", "age": 40, "tags": ["a", {"b": 1}]},
+			"sue": {"email": {"work": "sue@example.com"}, "age": 30},
+			"tim": {"age": 20}
+		},
+		"items": [
+			{"price": 1.5, "name": "x"},
+			{"name": "y"},
+			{"price": 3, "name": "z"}
+		],
+		"matrix": [[1, 2], [3, 4]],
+		"other": "skipped é \"quoted\" [{"
+	}`
+
+	tests := []struct {
+		desc     string
+		patterns []string
+		want     string
+	}{
+		{
+			desc:     "wildcard key",
+			patterns: []string{"user/*/email"},
+			want:     `{"user":{"bob":{"email":"bob@example.com"},"sue":{"email":{"work":"sue@example.com"}}}}`,
+		},
+		{
+			desc:     "array index",
+			patterns: []string{"items/#/price"},
+			want:     `{"items":[{"price":1.5},{"price":3}]}`,
+		},
+		{
+			desc:     "many patterns",
+			patterns: []string{"items/1", "other", "user/bob/tags/1/b"},
+			want:     `{"user":{"bob":{"tags":[{"b":1}]}},"items":[{"name":"y"}],"other":"skipped é \"quoted\" [{"}`,
+		},
+		{
+			desc:     "nested arrays",
+			patterns: []string{"matrix/#/1"},
+			want:     `{"matrix":[[2],[4]]}`,
+		},
+		{
+			desc:     "# does not match a key",
+			patterns: []string{"user/#/email"},
+			want:     `{}`,
+		},
+		{
+			desc:     "whole subtree",
+			patterns: []string{"/user/sue/"},
+			want:     `{"user":{"sue":{"email":{"work":"sue@example.com"},"age":30}}}`,
+		},
+		{
+			desc:     "no match",
+			patterns: []string{"nothing/here"},
+			want:     `{}`,
+		},
+		{
+			desc:     "empty pattern matches everything",
+			patterns: []string{"nothing", ""},
+			want:     `{"user":{"bob":{"email":"bob@example.com","age":40,"tags":["a",{"b":1}]},"sue":{"email":{"work":"sue@example.com"},"age":30},"tim":{"age":20}},"items":[{"price":1.5,"name":"x"},{"name":"y"},{"price":3,"name":"z"}],"matrix":[[1,2],[3,4]],"other":"skipped é \"quoted\" [{"}`,
+		},
+	}
+
+	for _, test := range tests {
+		d, err := UnmarshalJSON(strings.NewReader(text), WithPaths(test.patterns...))
+		if err != nil {
+			t.Errorf("TestPaths(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		buff := &bytes.Buffer{}
+		if err := MarshalJSON(buff, d); err != nil {
+			t.Errorf("TestPaths(%s): MarshalJSON had error: %s", test.desc, err)
+			continue
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestPaths(%s): got %s, want %s", test.desc, buff.String(), test.want)
+		}
+	}
+
+	// The result is a normal Directory.
+	d, err := UnmarshalJSON(strings.NewReader(text), WithPaths("items/#/price"))
+	if err != nil {
+		t.Fatalf("TestPaths: got err == %s, want err == nil", err)
+	}
+	f, err := NewMemFS(d).ReadFile("items/1/price")
+	if err != nil || string(f) != "3" {
+		t.Errorf("TestPaths(MemFS): got %s, %v, want 3, nil", f, err)
+	}
+}
+
+func TestPathsStream(t *testing.T) {
+	const text = `[{"a": 1, "b": 2}, {"b": 3}, 4]`
+
+	var got []string
+	for s := range UnmarshalArrayStream(context.Background(), strings.NewReader(text), WithPaths("b")) {
+		if s.Err != nil {
+			t.Fatalf("TestPathsStream: got err == %s, want err == nil", s.Err)
+		}
+		buff := &bytes.Buffer{}
+		MarshalJSON(buff, s.Value)
+		got = append(got, buff.String())
+	}
+	if want := []string{`{"b":2}`, `{"b":3}`, `4`}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("TestPathsStream: got %v, want %v", got, want)
+	}
+}
+
+func TestPathsErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		options []DecodeOption
+	}{
+		{desc: "bad number", input: `{"a": 1, "b": [1, 01]}`},
+		{desc: "bad escape", input: `{"a": 1, "b": {"c": "\x"}}`},
+		{desc: "missing colon", input: `{"a": 1, "b": {"c" 1}}`},
+		{desc: "mismatched close", input: `{"a": 1, "b": {"c": 1]}`},
+		{desc: "mismatched empty close", input: `{"a": 1, "b": [}`},
+		{desc: "truncated", input: `{"a": 1, "b": [1, 2`},
+		{desc: "bad literal", input: `{"a": 1, "b": nul}`},
+		{desc: "too deep", input: `{"a": 1, "b": [[[[1]]]]}`, options: []DecodeOption{WithLimits(Limits{MaxDepth: 3})}},
+	}
+
+	for _, test := range tests {
+		options := append([]DecodeOption{WithPaths("a")}, test.options...)
+		if _, err := UnmarshalJSON(strings.NewReader(test.input), options...); err == nil {
+			t.Errorf("TestPathsErrors(%s): got err == nil, want err != nil", test.desc)
+		}
+	}
+
+	relaxed := "{a: 1, // comment\n b: [0x1F, 'x\\'', {c: Infinity,},],}"
+	d, err := UnmarshalJSON(strings.NewReader(relaxed), WithPaths("a"), WithRelaxed(), WithNonFinite())
+	if err != nil {
+		t.Fatalf("TestPathsErrors(relaxed): got err == %s, want err == nil", err)
+	}
+	if f, err := d.GetFile("a"); err != nil || f.IntOrZV() != 1 {
+		t.Errorf("TestPathsErrors(relaxed): got %v, %v, want 1, nil", f.Any(), err)
+	}
+}
+
+func TestSkipValueAllocs(t *testing.T) {
+	const value = `{"a": [1, -2.5e10, "b\né", true, false, null, {}, [], {"c": {"d": [[]]}}]} `
+	d := newDecoder(bufio.NewReader(strings.NewReader(strings.Repeat(value, 200))), decodeOptions{})
+	defer d.close()
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := skipValue(d); err != nil {
+			panic(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("TestSkipValueAllocs: got %v allocs, want 0", allocs)
+	}
+}
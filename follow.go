@@ -0,0 +1,179 @@
+package jsonfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// WithPollInterval sets how often FollowStream() checks a file for new input
+// when it has read all of it. The default is 250 milliseconds.
+func WithPollInterval(d time.Duration) DecodeOption {
+	return func(o *decodeOptions) {
+		o.poll = d
+	}
+}
+
+// FollowStream is like UnmarshalStream() for the file at path, but keeps
+// decoding values as they are appended to the file, like "tail -f". This is
+// for watching NDJSON logs as they are written. The values already in the file
+// are decoded first. The channel is only closed when ctx is canceled or an
+// error stops the stream, the same as with UnmarshalStream().
+//
+// If the file is truncated, such as by logrotate's copytruncate, decoding starts
+// over at the start of it. If the file is moved away and a new file is created
+// at path, the rest of the old file is decoded and then the new file is. A value
+// that is cut short by this is sent with an error and following goes on. Index
+// counts every value, but Start and End are offsets in the file the value was
+// in. Truncation is found by the file being smaller than what was read, so it
+// is missed if the file grows past that before it is checked.
+func FollowStream(ctx context.Context, path string, options ...DecodeOption) chan Stream {
+	opts := newDecodeOptions(options)
+	if opts.poll <= 0 {
+		opts.poll = 250 * time.Millisecond
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errStream(err)
+	}
+
+	ch := make(chan Stream, 1)
+	go func() {
+		defer close(ch)
+
+		var sum StreamSummary
+		defer sum.save(opts.summary)
+		inner := opts
+		inner.summary = nil
+
+		index := 0
+		for {
+			r := &followReader{ctx: ctx, f: f, path: path, poll: opts.poll}
+			n, failed := 0, false
+			for s := range unmarshalStream(ctx, r, 0, inner) {
+				s.Index += index
+				n++
+				if !sum.send(ctx, ch, s) {
+					failed = true
+				}
+			}
+			index += n
+
+			if err := checkCtx(ctx); err != nil || (failed && !r.truncated && !r.rotated) {
+				f.Close()
+				return
+			}
+			if f, err = r.next(); err != nil {
+				sendStream(ctx, ch, Stream{Index: index, Err: err})
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// followReader reads from a file that is being appended to, waiting for more
+// input at the end of it instead of returning io.EOF. It returns io.EOF once the
+// file was truncated or moved away from path, when next() must be called.
+type followReader struct {
+	ctx  context.Context
+	f    *os.File
+	path string
+	poll time.Duration
+	// read is how much of f has been read.
+	read int64
+
+	// truncated is set if f was truncated and rotated is set if path is no
+	// longer f.
+	truncated, rotated bool
+}
+
+// Read implements io.Reader.Read().
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.read += int64(n)
+		switch {
+		case n > 0:
+			return n, nil
+		case err != nil && err != io.EOF:
+			return 0, err
+		case r.rotated:
+			return 0, io.EOF // We have read what was written before it was moved.
+		}
+
+		if err := r.check(); err != nil {
+			return 0, err
+		}
+		switch {
+		case r.truncated:
+			return 0, io.EOF
+		case r.rotated:
+			continue // Read what was written while we checked.
+		}
+
+		t := time.NewTimer(r.poll)
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			t.Stop()
+			return 0, checkCtx(r.ctx)
+		}
+	}
+}
+
+// check sets truncated or rotated if the file was truncated or moved away.
+func (r *followReader) check() error {
+	fi, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	if fi.Size() < r.read {
+		r.truncated = true
+		return nil
+	}
+
+	pfi, err := os.Stat(r.path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		r.rotated = true
+	case err != nil:
+		return err
+	case !os.SameFile(fi, pfi):
+		r.rotated = true
+	}
+	return nil
+}
+
+// next returns the file to read after r returned io.EOF. This is the same
+// file from the start if it was truncated, otherwise it is the file at path,
+// which is waited for if there is none.
+func (r *followReader) next() (*os.File, error) {
+	if r.truncated {
+		if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+			r.f.Close()
+			return nil, fmt.Errorf("could not seek to the start of truncated file %q: %w", r.path, err)
+		}
+		return r.f, nil
+	}
+
+	r.f.Close()
+	for {
+		f, err := os.Open(r.path)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return f, err
+		}
+
+		t := time.NewTimer(r.poll)
+		select {
+		case <-t.C:
+		case <-r.ctx.Done():
+			t.Stop()
+			return nil, checkCtx(r.ctx)
+		}
+	}
+}
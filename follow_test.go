@@ -0,0 +1,109 @@
+package jsonfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// follower reads the values from a FollowStream().
+type follower struct {
+	t  *testing.T
+	ch chan Stream
+}
+
+// want reads len(want) values and checks that they are want.
+func (f follower) want(desc string, want ...string) {
+	f.t.Helper()
+	for _, w := range want {
+		select {
+		case s, ok := <-f.ch:
+			if !ok {
+				f.t.Fatalf("TestFollowStream(%s): channel closed, want %s", desc, w)
+			}
+			if s.Err != nil {
+				f.t.Fatalf("TestFollowStream(%s): got err == %s, want %s", desc, s.Err, w)
+			}
+			buff := &bytes.Buffer{}
+			MarshalJSON(buff, s.Value)
+			if buff.String() != w {
+				f.t.Errorf("TestFollowStream(%s): got %s, want %s", desc, buff, w)
+			}
+		case <-time.After(5 * time.Second):
+			f.t.Fatalf("TestFollowStream(%s): timed out waiting for %s", desc, w)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFollowStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.ndjson")
+	appendFile(t, path, "{\"a\": 1}\n{\"a\": 2}\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var sum StreamSummary
+	f := follower{t: t, ch: FollowStream(ctx, path, WithPollInterval(time.Millisecond), WithSkipErrors(&sum))}
+	f.want("in the file", `{"a":1}`, `{"a":2}`)
+
+	appendFile(t, path, "{\"a\": 3}\n{\"a\":")
+	f.want("appended", `{"a":3}`)
+	appendFile(t, path, " 4}\nbad\n{\"a\": 5}\n")
+	f.want("finished value", `{"a":4}`)
+	s := <-f.ch
+	var rErr *RecordError
+	if !errors.As(s.Err, &rErr) || string(rErr.Raw) != "bad" {
+		t.Fatalf("TestFollowStream(bad line): got %v, want a *RecordError for bad", s.Err)
+	}
+	f.want("after bad line", `{"a":5}`)
+
+	// Truncated, as by copytruncate.
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "{\"b\": 1}\n")
+	f.want("truncated", `{"b":1}`)
+
+	// Moved away, with input that was not read yet, and a new file made.
+	appendFile(t, path, "{\"b\": 2}\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "{\"c\": 1}\n")
+	f.want("rotated", `{"b":2}`, `{"c":1}`)
+	appendFile(t, path, "{\"c\": 2}\n")
+	s = <-f.ch
+	if s.Index != 9 || s.Start != 9 || s.End != 17 {
+		t.Errorf("TestFollowStream(rotated): got Index %d, Start %d, End %d, want 9, 9, 17", s.Index, s.Start, s.End)
+	}
+
+	cancel()
+	for s := range f.ch {
+		var cErr *CanceledError
+		if !errors.As(s.Err, &cErr) {
+			t.Errorf("TestFollowStream(canceled): got Stream %+v, want a *CanceledError", s)
+		}
+	}
+	if want := (StreamSummary{Decoded: 9, Skipped: 1}); sum != want {
+		t.Errorf("TestFollowStream: got summary %+v, want %+v", sum, want)
+	}
+
+	if s := <-FollowStream(context.Background(), path+".2"); !errors.Is(s.Err, os.ErrNotExist) {
+		t.Errorf("TestFollowStream(no file): got err == %v, want os.ErrNotExist", s.Err)
+	}
+}
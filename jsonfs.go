@@ -38,8 +38,27 @@ was faster.  But I had a mistake that became obvious with using a large file,
 
 # Important notes
 
-  - This doesn't support numbers larger than an Int64. If you need that, you need to use a string.
-  - This doesn't support anything other than decimal notation, but the JSON standard does. If someone needs it I'll add it.
+  - Numbers that do not fit in an int64 or float64 are stored as FTBigInt or FTDecimal and
+    are written back with exactly the digits that were read.
+  - Object keys keep the order they were read or added in. MarshalJSON() writes them in
+    that order and Directory.ReadDirInOrder() lists them in that order.
+  - A key that is repeated in a JSON object is an error by default. Use WithDuplicates()
+    to keep the first or last value or to collect the values into an array.
+  - When decoding untrusted input, use WithLimits() to limit the nesting depth and size
+    of the input.
+  - To only keep part of a large input, such as "items/#/price", use WithPaths(). The rest
+    is skipped without being kept in memory.
+  - For input that is already in memory, UnmarshalBytes() does not copy the values out
+    of it, so it must not be changed while the Directory is in use.
+  - To only parse the parts of a large input you use, use WithLazy(). Objects and arrays
+    are parsed when first used and the ones never used are marshaled by copying the input.
+  - UnmarshalStreamParallel() and UnmarshalArrayStreamParallel() decode the values of an
+    NDJSON stream or a large array on many goroutines, sending them in order by default.
+  - WithSkipErrors() lets a stream skip bad values, reporting each as a *RecordError.
+  - Each Stream has the Start and End offsets of its value. UnmarshalStreamFrom() resumes
+    a stream from an End that was saved as a checkpoint.
+  - FollowStream() decodes the values appended to a file as it grows, like "tail -f",
+    going on after the file is truncated or rotated.
   - This does not have []byte conversion to string as the standard lib provides.
   - There are likely bugs in here.
 
@@ -51,11 +70,15 @@ Example of unmarshalling a JSON file:
 	if err != nil {
 		// Do something
 	}
-	dir, err := UnmarshalJSON(ctx, f)
+	dir, err := UnmarshalJSON(f)
 	if err != nil {
 		// Do something
 	}
 
+If you need to be able to stop a large decode, use UnmarshalJSONContext(ctx, f) instead.
+To read hand edited config files that have comments and trailing commas, use
+UnmarshalJSON(f, WithRelaxed()).
+
 Example of creating a JSON object via the library:
 
 	dir := MustNewDir(
@@ -81,6 +104,35 @@ Example of marshaling a Directory:
 		// Do something
 	}
 
+Example of writing a Directory for humans to read:
+
+	enc := NewEncoder(os.Stdout, WithIndent("", "  "), WithCompactArrays(8), WithTrailingNewline())
+	if err := enc.Encode(dir); err != nil {
+		// Do something
+	}
+
+Example of prettifying a large file without loading it into memory:
+
+	if err := Reformat(os.Stdout, f, WithIndent("", "  ")); err != nil {
+		// Do something
+	}
+
+Example of reading the tokens of a large file without building a Directory:
+
+	s := NewScanner(f)
+	for {
+		tok, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Do something
+		}
+		if tok.Kind == TokenKey && string(tok.Value) == "email" {
+			// The next token is the email address, at path s.Path().
+		}
+	}
+
 Example of getting a JSON value by field name:
 
 	f, err := dir.GetFile("Identities/EmployeeID")
@@ -99,8 +151,8 @@ Get the type a File holds:
 Get a value the easiest way when you aren't sure what it is:
 
 	v := f.Any()
-	// Now you have to switch on types nil, string, bool, int64 or float
-	// In order to use it.
+	// Now you have to switch on types nil, string, bool, int64, float64,
+	// *big.Int or *big.Float in order to use it.
 
 Get a value from a Directory when you care about all the details (uck):
 
@@ -142,14 +194,26 @@ Put the value in an fs.FS and walk the JSON:
 		}
 		return nil
 	})
+
+Walk the same JSON as it is read, without building a Directory:
+
+	err := Walk(f, HandlerFuncs{
+		Value: func(p string, f File) error {
+			fmt.Printf("%s:%s:%v\n", p, f.JSONType(), f.Any())
+			return nil
+		},
+	})
 */
 package jsonfs
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"math"
+	"math/big"
 	"path"
 	"sort"
 	"strconv"
@@ -193,6 +257,12 @@ const (
 	FTInt    FileType = 2
 	FTFloat  FileType = 3
 	FTString FileType = 4
+	// FTBigInt is an integer that will not fit in an int64. Use File.BigInt()
+	// or File.Number() to get the value.
+	FTBigInt FileType = 5
+	// FTDecimal is a number with a fraction or exponent that would lose digits
+	// if converted to a float64. Use File.BigFloat() or File.Number() to get the value.
+	FTDecimal FileType = 6
 )
 
 // File represents a value in JSON. This can be a string, bool or number.
@@ -208,8 +278,10 @@ type File struct {
 // NewFile creates a new file named "name" with value []byte. Files created
 // with NewFile cannot have .Read() called, as this only works when opened
 // from FS or a Directory.  This simply is used to help construct a JSON value.
-// value can be any type of int, string, bool or float. A nil value stands for
-// a JSON null.
+// value can be any type of int, string, bool or float. A float gets the
+// FileType its JSON would unmarshal to, so 2.0 is an FTInt. A nil value stands for
+// a JSON null. Numbers that need more precision can be passed as a *big.Int,
+// *big.Float or json.Number.
 func NewFile(name string, value any) (File, error) {
 	var b []byte
 	var t FileType
@@ -230,11 +302,43 @@ func NewFile(name string, value any) (File, error) {
 		t = FTInt
 		b = UnsafeGetBytes(strconv.FormatInt(int64(x), 10))
 	case float32:
-		t = FTFloat
-		b = UnsafeGetBytes(strconv.FormatFloat(float64(x), 'f', -1, 32))
+		if math.IsNaN(float64(x)) || math.IsInf(float64(x), 0) {
+			return File{}, fmt.Errorf("%v is not a valid JSON number", x)
+		}
+		b = appendES6Number(nil, float64(x), 32)
+		t, _ = numberType(b) // Like unmarshaling b, so 1e21 is FTFloat and 2.0 is FTInt.
 	case float64:
-		t = FTFloat
-		b = UnsafeGetBytes(strconv.FormatFloat(float64(x), 'f', -1, 64))
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return File{}, fmt.Errorf("%v is not a valid JSON number", x)
+		}
+		b = appendES6Number(nil, x, 64)
+		t, _ = numberType(b)
+	case *big.Int:
+		if x == nil {
+			return File{}, fmt.Errorf("*big.Int cannot be nil")
+		}
+		b = UnsafeGetBytes(x.String())
+		t, _ = numberType(b) // A big.Int always gives a valid number
+	case *big.Float:
+		if x == nil {
+			return File{}, fmt.Errorf("*big.Float cannot be nil")
+		}
+		if x.IsInf() {
+			return File{}, fmt.Errorf("%v is not a valid JSON number", x)
+		}
+		b = UnsafeGetBytes(x.Text('g', -1))
+		var err error
+		t, err = numberType(b)
+		if err != nil {
+			return File{}, err
+		}
+	case json.Number:
+		b = UnsafeGetBytes(string(x))
+		var err error
+		t, err = numberType(b)
+		if err != nil {
+			return File{}, err
+		}
 	case bool:
 		t = FTBool
 		if x {
@@ -244,10 +348,7 @@ func NewFile(name string, value any) (File, error) {
 		}
 	case string:
 		t = FTString
-		b = make([]byte, 0, len(x)+2)
-		b = append(b, doubleQuote)
-		b = append(b, UnsafeGetBytes(x)...)
-		b = append(b, doubleQuote)
+		b = UnsafeGetBytes(x)
 	case nil:
 		t = FTNull
 		b = []byte("null")
@@ -358,9 +459,10 @@ func (f File) BoolorZV() bool {
 	return b
 }
 
-// Float returns a file's value if it is a float.
+// Float returns a file's value if it is a float. Any other number type is
+// converted to a float64, which may lose precision for FTBigInt and FTDecimal.
 func (f File) Float() (float64, error) {
-	if f.t != FTFloat {
+	if !f.isNumber() {
 		return 0.0, fmt.Errorf("was %v, not float", f.t)
 	}
 	s := ByteSlice2String(f.value)
@@ -379,13 +481,82 @@ func (f File) FloatOrZV() float64 {
 	return fl
 }
 
-// Int returns a file's value if it is a int.
+// Int returns a file's value if it is a int. An FTFloat that holds an integral
+// value that fits in an int64, such as 1e3, is also returned.
 func (f File) Int() (int64, error) {
-	if f.t != FTInt {
-		return 0, fmt.Errorf("was %v, not int", f.t)
+	s := ByteSlice2String(f.value)
+	switch f.t {
+	case FTInt, FTBigInt:
+		return strconv.ParseInt(s, 10, 64)
+	case FTFloat, FTDecimal:
+		fl, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		if fl != math.Trunc(fl) || fl < math.MinInt64 || fl >= math.MaxInt64 {
+			return 0, fmt.Errorf("float value %s cannot be represented as an int64", s)
+		}
+		return int64(fl), nil
 	}
+	return 0, fmt.Errorf("was %v, not int", f.t)
+}
+
+// Number returns the number exactly as it was written in the JSON for any
+// of the number types.
+func (f File) Number() (json.Number, error) {
+	if !f.isNumber() {
+		return "", fmt.Errorf("was %v, not a number", f.t)
+	}
+	return json.Number(f.value), nil
+}
+
+// BigInt returns a file's value as a *big.Int. This works for any number
+// type that holds an integral value.
+func (f File) BigInt() (*big.Int, error) {
 	s := ByteSlice2String(f.value)
-	return strconv.ParseInt(s, 10, 64)
+	switch f.t {
+	case FTInt, FTBigInt:
+		i, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, fmt.Errorf("malformed int value %s", s)
+		}
+		return i, nil
+	case FTFloat, FTDecimal:
+		fl, err := f.BigFloat()
+		if err != nil {
+			return nil, err
+		}
+		i, acc := fl.Int(nil)
+		if acc != big.Exact {
+			return nil, fmt.Errorf("float value %s cannot be represented as an integer", s)
+		}
+		return i, nil
+	}
+	return nil, fmt.Errorf("was %v, not int", f.t)
+}
+
+// BigFloat returns a file's value as a *big.Float for any number type. The
+// precision is set high enough to hold every digit of the value. Remember
+// that a big.Float is binary, so use Number() if you need the exact decimal digits.
+func (f File) BigFloat() (*big.Float, error) {
+	if !f.isNumber() {
+		return nil, fmt.Errorf("was %v, not float", f.t)
+	}
+	s := ByteSlice2String(f.value)
+	prec := uint(len(f.value))*4 + 64
+	fl, _, err := big.ParseFloat(s, 10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (f File) isNumber() bool {
+	switch f.t {
+	case FTInt, FTFloat, FTBigInt, FTDecimal:
+		return true
+	}
+	return false
 }
 
 func (f File) IntOrZV() int64 {
@@ -434,27 +605,37 @@ func (f File) Any() any {
 	case FTFloat:
 		x, _ := f.Float()
 		return x
+	case FTBigInt:
+		x, _ := f.BigInt()
+		return x
+	case FTDecimal:
+		x, _ := f.BigFloat()
+		return x
 	}
 	return nil
 }
 
 // EncodeJSON outputs the file data as into the writer.
 func (f File) EncodeJSON(w io.Writer) error {
+	return f.encodeJSON(w, encodeOptions{})
+}
+
+func (f File) encodeJSON(w io.Writer, opts encodeOptions) error {
 	switch f.t {
 	case FTString:
-		err := WriteOut(w, doubleQuote)
-		if err != nil {
-			return err
+		return writeString(w, f.value, opts.htmlSafe)
+	case FTInt, FTBigInt, FTDecimal:
+		if opts.canonical {
+			return writeCanonicalNumber(w, f)
 		}
-		err = WriteOut(w, f.value)
-		if err != nil {
-			return err
+	case FTFloat:
+		if opts.canonical {
+			return writeCanonicalNumber(w, f)
 		}
-		err = WriteOut(w, doubleQuote)
-		if err != nil {
-			return err
+		// A finite number always ends in a digit, unlike Infinity and NaN.
+		if len(f.value) > 0 && !isDigit(f.value[len(f.value)-1]) {
+			return fmt.Errorf("cannot encode non-finite number %s as JSON", f.value)
 		}
-		return nil
 	}
 	return WriteOut(w, f.value)
 }
@@ -478,8 +659,15 @@ type Directory struct {
 	name    string
 	modTime time.Time
 	objs    map[string]Object
+	// order holds the names in objs in the order they were added. This is
+	// a pointer so that it is shared by copies of the Directory, like objs.
+	// It is not used for arrays, which are in index order.
+	order *[]string
 
 	isArray bool
+	// lazy is set for a Directory from WithLazy(). It holds the input until
+	// the Directory is parsed.
+	lazy *lazyDir
 
 	mu *sync.RWMutex
 }
@@ -489,19 +677,18 @@ type Directory struct {
 // level directory does not have to have a name.
 func NewDir(name string, filesOrDirs ...any) (Directory, error) {
 	d := newDir(name, time.Now())
-	d.isArray = true
 	for _, fd := range filesOrDirs {
 		switch x := fd.(type) {
 		case File:
 			if x.name == "" {
 				return Directory{}, fmt.Errorf("a passed File had no name")
 			}
-			d.objs[x.name] = Object{Type: OTFile, File: x}
+			d.setObj(x.name, Object{Type: OTFile, File: x})
 		case Directory:
 			if x.name == "" {
 				return Directory{}, fmt.Errorf("a passed Directory had no name")
 			}
-			d.objs[x.name] = Object{Type: OTDir, Dir: x}
+			d.setObj(x.name, Object{Type: OTDir, Dir: x})
 		default:
 			return Directory{}, fmt.Errorf("%T is not a supported type", fd)
 		}
@@ -522,6 +709,7 @@ func MustNewDir(name string, filesOrDirs ...any) Directory {
 // filesOrDirs that have names will have them overridden.
 func NewArray(name string, filesOrDirs ...any) (Directory, error) {
 	d := newDir(name, time.Now()) // escape: maps
+	d.isArray = true
 	for i, fd := range filesOrDirs {
 		switch x := fd.(type) {
 		case Directory:
@@ -551,9 +739,71 @@ func newDir(name string, modTime time.Time) Directory {
 		name:    name,
 		modTime: time.Time{},
 		objs:    map[string]Object{},
+		order:   &[]string{},
+	}
+}
+
+// load parses the Directory if it is from WithLazy() and has not been parsed.
+// Copies of the Directory share what is parsed. If parsing fails, the
+// Directory is empty and the error is returned by every call.
+func (d Directory) load() error {
+	if d.lazy == nil {
+		return nil
+	}
+	return d.lazy.load(d)
+}
+
+// setObj adds o to the Directory as name. A new name goes after all the
+// existing names, while replacing an existing name keeps its place.
+func (d Directory) setObj(name string, o Object) {
+	d.load()
+	if _, ok := d.objs[name]; !ok && !d.isArray && d.order != nil {
+		*d.order = append(*d.order, name)
+	}
+	d.objs[name] = o
+}
+
+// delObj removes name from the Directory.
+func (d Directory) delObj(name string) {
+	d.load()
+	if _, ok := d.objs[name]; !ok {
+		return
+	}
+	delete(d.objs, name)
+	if d.isArray || d.order == nil {
+		return
+	}
+	names := *d.order
+	for i, n := range names {
+		if n == name {
+			*d.order = append(names[:i], names[i+1:]...)
+			return
+		}
 	}
 }
 
+// names returns the names in the Directory in the order they were added. For
+// an array, this is index order.
+func (d Directory) names() []string {
+	d.load()
+	switch {
+	case d.isArray:
+		names := make([]string, 0, len(d.objs))
+		for i := 0; i < len(d.objs); i++ {
+			names = append(names, strconv.Itoa(i))
+		}
+		return names
+	case d.order == nil: // Not made with newDir(), so there is no order.
+		names := make([]string, 0, len(d.objs))
+		for name := range d.objs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	return *d.order
+}
+
 func (d Directory) isFileOrDir() {}
 
 // Name implements fs.DirEntry.Name().
@@ -602,6 +852,9 @@ func (d Directory) ReadDir(n int) ([]fs.DirEntry, error) {
 		d.mu.RLock()
 		defer d.mu.RUnlock()
 	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
 
 	de := make([]fs.DirEntry, 0, len(d.objs))
 	for _, obj := range d.objs {
@@ -631,6 +884,40 @@ func (d Directory) ReadDir(n int) ([]fs.DirEntry, error) {
 	return de, nil
 }
 
+// ReadDirInOrder is like ReadDir(), except the entries are in the order they
+// were added to the Directory instead of sorted by name. For a Directory from
+// UnmarshalJSON(), this is the order the keys were in the input. For an array,
+// this is index order.
+func (d Directory) ReadDirInOrder(n int) ([]fs.DirEntry, error) {
+	if d.mu != nil {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+
+	names := d.names()
+	if n > 0 && len(names) > n {
+		names = names[:n]
+	}
+	de := make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		obj := d.objs[name]
+		switch obj.Type {
+		case OTFile:
+			de = append(de, obj.File)
+		case OTDir:
+			de = append(de, obj.Dir)
+		}
+	}
+
+	if len(de) == 0 && n > 0 {
+		return de, io.EOF
+	}
+	return de, nil
+}
+
 // Close implememnts fs.ReadDirFile.Close().
 func (d Directory) Close() error {
 	return nil
@@ -660,6 +947,9 @@ func (d Directory) GetDir(name string) (Directory, error) {
 	}
 
 	for i := 0; i < len(p)-1; i++ {
+		if err := dir.load(); err != nil {
+			return Directory{}, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
 		v, ok := dir.objs[p[i]]
 		if !ok {
 			return Directory{}, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("could not find directory %q", strings.Join(p, "/"))}
@@ -670,6 +960,9 @@ func (d Directory) GetDir(name string) (Directory, error) {
 		dir = v.Dir
 	}
 	fn := p[len(p)-1]
+	if err := dir.load(); err != nil {
+		return Directory{}, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
 	o, ok := dir.objs[fn]
 	if ok && o.Type == OTDir {
 		return o.Dir, nil
@@ -703,6 +996,9 @@ func (d Directory) GetFile(name string) (File, error) {
 		}
 		dir = dd
 	}
+	if err := dir.load(); err != nil {
+		return File{}, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
 	o, ok := dir.objs[fileName]
 	if ok && o.Type == OTFile {
 		return o.File, nil
@@ -713,8 +1009,8 @@ func (d Directory) GetFile(name string) (File, error) {
 func (d Directory) GetObjects() chan Object {
 	ch := make(chan Object, 1)
 	go func() {
-		for _, o := range d.objs {
-			ch <- o
+		for _, name := range d.names() {
+			ch <- d.objs[name]
 		}
 	}()
 	return ch
@@ -735,6 +1031,9 @@ func (d Directory) remove(name string, children bool) error {
 		d.mu.RLock()
 		defer d.mu.RUnlock()
 	}
+	if err := d.load(); err != nil {
+		return err
+	}
 
 	o, ok := d.objs[name]
 	if !ok {
@@ -742,12 +1041,12 @@ func (d Directory) remove(name string, children bool) error {
 	}
 	switch o.Type {
 	case OTDir:
-		if len(o.Dir.objs) != 0 && !children {
+		if o.Dir.Len() != 0 && !children {
 			return fmt.Errorf("directory(%s) was not empty", name)
 		}
-		delete(o.Dir.objs, name)
+		d.delObj(name)
 	case OTFile:
-		delete(d.objs, name)
+		d.delObj(name)
 	default:
 		panic("unsuported object type")
 	}
@@ -772,7 +1071,7 @@ func (d Directory) WriteFile(name string, data []byte) error {
 		return err
 	}
 
-	d.objs[name] = Object{Type: OTFile, File: f}
+	d.setObj(name, Object{Type: OTFile, File: f})
 	return nil
 }
 
@@ -782,6 +1081,7 @@ func (d Directory) Len() int {
 		d.mu.RLock()
 		defer d.mu.RUnlock()
 	}
+	d.load()
 
 	return len(d.objs)
 }
@@ -813,121 +1113,170 @@ func (d Directory) Set(filesOrDirs ...any) error {
 	for _, fd := range filesOrDirs {
 		switch x := fd.(type) {
 		case File:
-			d.objs[x.name] = Object{Type: OTFile, File: x}
+			d.setObj(x.name, Object{Type: OTFile, File: x})
 		case Directory:
-			d.objs[x.name] = Object{Type: OTDir, Dir: x}
+			d.setObj(x.name, Object{Type: OTDir, Dir: x})
 		}
 	}
 	return nil
 }
 
-// EncodeJSON encodes the Directory as JSON into the io.Writer passed.
+// EncodeJSON encodes the Directory as a JSON object or array into the io.Writer passed.
 func (d Directory) EncodeJSON(w io.Writer) error {
+	return d.encodeJSON(w, encodeOptions{})
+}
+
+func (d Directory) encodeJSON(w io.Writer, opts encodeOptions) error {
+	if d.lazy != nil {
+		// If it has not been used, copy it from the input.
+		if ok, err := d.lazy.encodeJSON(w, opts); ok || err != nil {
+			return err
+		}
+	}
+	if err := d.load(); err != nil {
+		return err
+	}
 	if d.isArray {
-		return fmt.Errorf("must encode from a Directory that is not an array")
+		return d.encodeJSONArray(w, opts)
 	}
-	return d.encodeJSONDict(w)
+	return d.encodeJSONDict(w, opts)
 }
 
-func (d Directory) encodeJSONArray(w io.Writer) error {
+func (d Directory) encodeJSONArray(w io.Writer, opts encodeOptions) error {
 	if err := WriteOut(w, openBracket); err != nil {
 		return err
 	}
 
-	for i := 0; i < len(d.objs); i++ {
+	l := len(d.objs)
+	pretty := opts.pretty() && !(l <= opts.compactArrays && d.onlyFiles())
+	inner := opts
+	inner.depth++
+	for i := 0; i < l; i++ {
 		is := strconv.Itoa(i)
 		o, ok := d.objs[is]
 		if !ok {
 			return fmt.Errorf("Directory was not a valid array, missing array index %d", i)
 		}
 
-		switch o.Type {
-		case OTFile:
-			if err := o.File.EncodeJSON(w); err != nil {
+		if i > 0 {
+			if err := WriteOut(w, comma); err != nil {
 				return err
 			}
-		case OTDir:
-			if o.Dir.isArray {
-				if err := o.Dir.encodeJSONArray(w); err != nil {
-					return err
-				}
-			} else {
-				if err := o.Dir.encodeJSONDict(w); err != nil {
+			if opts.pretty() && !pretty {
+				if err := WriteOut(w, ' '); err != nil {
 					return err
 				}
 			}
 		}
+		if pretty {
+			if err := writeIndent(w, inner); err != nil {
+				return err
+			}
+		}
 
-		if i < len(d.objs)-1 {
-			if err := WriteOut(w, comma); err != nil {
+		switch o.Type {
+		case OTFile:
+			if err := o.File.encodeJSON(w, inner); err != nil {
+				return err
+			}
+		case OTDir:
+			if err := o.Dir.encodeJSON(w, inner); err != nil {
 				return err
 			}
 		}
 	}
+	if pretty && l > 0 {
+		if err := writeIndent(w, opts); err != nil {
+			return err
+		}
+	}
 	if err := WriteOut(w, closeBracket); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (d Directory) encodeJSONDict(w io.Writer) error {
+// onlyFiles reports if the Directory only holds Files.
+func (d Directory) onlyFiles() bool {
+	for _, o := range d.objs {
+		if o.Type != OTFile {
+			return false
+		}
+	}
+	return true
+}
+
+func (d Directory) encodeJSONDict(w io.Writer, opts encodeOptions) error {
 	if err := WriteOut(w, openBrace); err != nil {
 		return err
 	}
 
-	l := len(d.objs)
-	i := 0
-	for _, o := range d.objs {
-		if err := WriteOut(w, doubleQuote); err != nil {
-			return err
+	names := d.names()
+	switch {
+	case opts.canonical:
+		names = sortUTF16(names)
+	case opts.sortKeys:
+		names = append([]string(nil), names...)
+		sort.Strings(names)
+	}
+	pretty := opts.pretty()
+	inner := opts
+	inner.depth++
+	for i, name := range names {
+		o := d.objs[name]
+		if i > 0 {
+			if err := WriteOut(w, comma); err != nil {
+				return err
+			}
 		}
+		if pretty {
+			if err := writeIndent(w, inner); err != nil {
+				return err
+			}
+		}
+
 		switch o.Type {
 		case OTFile:
-			if err := WriteOut(w, o.File.name); err != nil {
+			if err := writeString(w, UnsafeGetBytes(o.File.name), opts.htmlSafe); err != nil {
 				return err
 			}
 		case OTDir:
-			if err := WriteOut(w, o.Dir.name); err != nil {
+			if err := writeString(w, UnsafeGetBytes(o.Dir.name), opts.htmlSafe); err != nil {
 				return err
 			}
 		}
-		if err := WriteOut(w, doubleQuote); err != nil {
-			return err
-		}
 		if err := WriteOut(w, colon); err != nil {
 			return err
 		}
+		if pretty {
+			if err := WriteOut(w, ' '); err != nil {
+				return err
+			}
+		}
 		switch o.Type {
 		case OTFile:
-			if err := o.File.EncodeJSON(w); err != nil {
+			if err := o.File.encodeJSON(w, inner); err != nil {
 				return err
 			}
 		case OTDir:
-			if o.Dir.isArray {
-				if err := o.Dir.encodeJSONArray(w); err != nil {
-					return err
-				}
-			} else {
-				if err := o.Dir.encodeJSONDict(w); err != nil {
-					return err
-				}
-			}
-		}
-		if i < l-1 {
-			if err := WriteOut(w, comma); err != nil {
+			if err := o.Dir.encodeJSON(w, inner); err != nil {
 				return err
 			}
 		}
-		i++
 	}
 
+	if pretty && len(names) > 0 {
+		if err := writeIndent(w, opts); err != nil {
+			return err
+		}
+	}
 	if err := WriteOut(w, closeBrace); err != nil {
 		return err
 	}
 	return nil
 }
 
-// FileOrDir stands can hold a File or Directory.
+// FileOrDir can hold a File or Directory.
 type FileOrDir interface {
 	isFileOrDir()
 }
@@ -968,6 +1317,9 @@ func Append[FD FileOrDir](array Directory, filesOrDirs ...FD) error {
 	if !array.isArray {
 		return fmt.Errorf("cannot append to a Dictionary that is not an array")
 	}
+	if err := array.load(); err != nil {
+		return err
+	}
 
 	start := len(array.objs)
 	for i, fd := range filesOrDirs {
@@ -995,16 +1347,28 @@ func CP[FD FileOrDir](fileOrDir FD) FD {
 	// pointing at the same locations.
 	switch x := any(fileOrDir).(type) {
 	case Directory:
+		// A lazy Directory that was not parsed copies its input, one that
+		// was is copied below like any other.
+		if x.lazy != nil {
+			if c, ok := x.lazy.cp(x); ok {
+				return any(c).(FD)
+			}
+		}
 		if x.mu != nil {
 			x.mu.RLock()
 			defer x.mu.RUnlock()
 		}
 
-		x.objs = make(map[string]Object, len(x.objs))
+		objs := x.objs
+		x.objs = make(map[string]Object, len(objs))
+		if x.order != nil {
+			order := append([]string(nil), *x.order...)
+			x.order = &order
+		}
 		if x.mu != nil {
 			x.mu = &sync.RWMutex{}
 		}
-		for k, v := range x.objs {
+		for k, v := range objs {
 			switch v.Type {
 			case OTDir:
 				x.objs[k] = Object{Type: OTDir, Dir: CP(v.Dir)}
@@ -1012,11 +1376,13 @@ func CP[FD FileOrDir](fileOrDir FD) FD {
 				x.objs[k] = Object{Type: OTFile, File: CP(v.File)}
 			}
 		}
+		return any(x).(FD)
 	case File:
 		b := make([]byte, len(x.value))
 		copy(b, x.value)
 		x.value = b
 		x.readValue = nil
+		return any(x).(FD)
 	}
 	return fileOrDir
 }
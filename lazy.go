@@ -0,0 +1,247 @@
+package jsonfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithLazy causes UnmarshalJSON(), UnmarshalJSONContext() and UnmarshalBytes()
+// to only check the input and keep it in memory, instead of building the whole
+// Directory. An object or array is parsed the first time it is used, such as
+// by GetDir(), GetFile(), ReadDir() or an FS like MemFS. Only that object or
+// array is parsed, the objects and arrays in it wait until they are used. An
+// object or array that was never used is marshaled by copying it from the
+// input. This is much faster and uses much less memory when you only look at a
+// small part of a large input.
+//
+// All of the input is read into memory, except with UnmarshalBytes(), but no
+// more of the value than Limits.MaxBytes. Syntax errors and Limits are found
+// by the Unmarshal function, but repeated keys, Limits.MaxKeys and
+// Limits.MaxArrayLen are only checked when an object or array is parsed. That
+// error is returned by the method that used it, such as ReadDir(), and the
+// object or array is empty. WithPaths() is ignored.
+func WithLazy() DecodeOption {
+	return func(o *decodeOptions) {
+		o.lazy = true
+	}
+}
+
+// lazyDir holds the JSON of a Directory from WithLazy() until it is parsed.
+// It is shared by all copies of the Directory.
+type lazyDir struct {
+	mu sync.Mutex
+	// input is all of the input. The object or array is input[start:end].
+	input      []byte
+	start, end int64
+	// line and lineStart are the decoder's line and lineStart at start, so that
+	// errors point at the right place.
+	line      int
+	lineStart int64
+	opts      decodeOptions
+	// path is the path of the object or array, used in errors.
+	path []string
+
+	// parsed is set once the object or array has been parsed and err is the
+	// error from parsing.
+	parsed bool
+	err    error
+}
+
+// unmarshalLazy reads the rest of d and returns a Directory for the object or
+// array at the start of it, which will be parsed when used.
+func unmarshalLazy(ctx context.Context, d *decoder) (Directory, error) {
+	opts := d.opts
+	input := d.input
+	if input == nil || opts.copy {
+		var err error
+		if input, err = readLazy(d); err != nil {
+			return Directory{}, err
+		}
+		opts.copy = false // The input is ours.
+	}
+
+	r := bytes.NewReader(input)
+	b := bufioReader(r)
+	defer putReader(b, r)
+	dec := newDecoder(b, d.opts)
+	defer dec.close()
+	dec.input = input
+
+	dec.startValue()
+	if x, err := dec.Peek(1); err != nil || (x[0] != openBrace && x[0] != openBracket) {
+		return decodeDict(ctx, dec, "") // This gives the same error as without WithLazy().
+	}
+	opts.paths = nil
+	dec.opts = opts
+
+	root, err := lazyChild(dec, "", time.Now())
+	if err != nil {
+		return Directory{}, dec.syntaxError(err)
+	}
+	if err := checkCtx(ctx); err != nil {
+		return Directory{}, err
+	}
+	return root, nil
+}
+
+// readLazy reads the rest of d into memory. With Limits.MaxBytes, no more of
+// the value than that is read, which is enough for decoding it to return the
+// *LimitError.
+func readLazy(d *decoder) ([]byte, error) {
+	if d.opts.limits.MaxBytes <= 0 {
+		return io.ReadAll(d.b)
+	}
+
+	// The space before the value is not counted, so it is read first. It is
+	// kept so that offsets in errors are right.
+	d.capturing = true
+	d.startValue()
+	input := d.capture
+	d.capturing, d.capture = false, nil
+	if d.readErr != nil {
+		return nil, d.readErr
+	}
+
+	var buff bytes.Buffer
+	buff.Write(input)
+	if _, err := buff.ReadFrom(io.LimitReader(d.b, d.opts.limits.MaxBytes+1)); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
+
+// lazyChild is used instead of decoding an object or array when b.lazy is
+// set. It skips the object or array that is next in b, which is named name,
+// and returns a Directory that will parse it when used.
+func lazyChild(b *decoder, name string, modTime time.Time) (Directory, error) {
+	l := &lazyDir{
+		input:     b.input,
+		start:     b.offset,
+		line:      b.line,
+		lineStart: b.lineStart,
+		opts:      b.opts,
+		path:      append([]string(nil), b.path...),
+	}
+	if err := skipValue(b); err != nil {
+		return Directory{}, err
+	}
+	l.end = b.offset
+	return l.dir(name, modTime), nil
+}
+
+// dir returns a new Directory that will be parsed from l when used.
+func (l *lazyDir) dir(name string, modTime time.Time) Directory {
+	d := newDir(name, modTime)
+	d.modTime = modTime
+	d.isArray = l.input[l.start] == openBracket
+	d.lazy = l
+	return d
+}
+
+// data returns the JSON of the object or array, or nil if it has been parsed.
+func (l *lazyDir) data() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.parsed {
+		return nil
+	}
+	return l.input[l.start:l.end]
+}
+
+// load parses the object or array into d, which must be the Directory it
+// belongs to, if it has not been parsed yet.
+func (l *lazyDir) load(d Directory) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.parsed {
+		return l.err
+	}
+	l.parsed = true
+
+	r := bytes.NewReader(l.input[l.start:l.end])
+	b := bufioReader(r)
+	defer putReader(b, r)
+	dec := newDecoder(b, l.opts)
+	defer dec.close()
+	dec.input, dec.lazy = l.input, true
+	dec.path = append(dec.path, l.path...)
+	before := l.start - recentLen
+	if before < 0 {
+		before = 0
+	}
+	dec.seek(l.start, l.line, l.lineStart, l.input[before:l.start])
+
+	var parsed Directory
+	if d.isArray {
+		parsed, l.err = decodeArray(context.Background(), dec, d.name, d.modTime)
+	} else {
+		parsed, l.err = decodeDict(context.Background(), dec, d.name)
+	}
+	if l.err != nil {
+		return l.err
+	}
+	for name, o := range parsed.objs {
+		d.objs[name] = o
+	}
+	*d.order = *parsed.order
+	return nil
+}
+
+// encodeJSON writes the JSON of the object or array to w if it has not been
+// parsed and the options allow copying it from the input. It reports if it
+// was written.
+func (l *lazyDir) encodeJSON(w io.Writer, opts encodeOptions) (bool, error) {
+	data := l.data()
+	switch {
+	case data == nil:
+		return false, nil
+	case opts.htmlSafe, opts.sortKeys, opts.canonical, opts.compactArrays > 0:
+		return false, nil
+	case l.opts.relaxed, l.opts.nonFinite: // The input may not be JSON.
+		return false, nil
+	}
+
+	r := bytes.NewReader(data)
+	b := bufioReader(r)
+	defer putReader(b, r)
+	dec := newDecoder(b, decodeOptions{})
+	defer dec.close()
+	bw := bufioWriter(w)
+	defer putWriter(bw, w)
+
+	s := newScanner(dec)
+	s.raw = true
+	opts.trailingNewline = false
+	rf := reformatter{s: s, w: bw, opts: opts, base: opts.depth}
+	if err := rf.run(); err != nil {
+		return true, err
+	}
+	if _, ok := w.(*bufio.Writer); !ok {
+		return true, bw.Flush()
+	}
+	return true, nil
+}
+
+// cp returns a copy of d, which must be the Directory l belongs to, if it has
+// not been parsed yet.
+func (l *lazyDir) cp(d Directory) (Directory, bool) {
+	if l.data() == nil {
+		return Directory{}, false
+	}
+	c := &lazyDir{
+		input:     l.input,
+		start:     l.start,
+		end:       l.end,
+		line:      l.line,
+		lineStart: l.lineStart,
+		opts:      l.opts,
+		path:      l.path,
+	}
+	return c.dir(d.name, d.modTime), true
+}
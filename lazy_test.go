@@ -0,0 +1,238 @@
+package jsonfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLazy(t *testing.T) {
+	const text = `{
+		"user": {
+			"bob": {"email": "bob@example.com", "age": 40, "tags": ["a", {"b": 1}]},
+			"sue": {"email": {"work": "sue@example.com"}, "age": 30}
+		},
+		"items": [{"price": 1.5, "name": "xé\n"}, [], {}],
+		"other": "skipped é \"quoted\" [{"
+	}`
+
+	eager, err := UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("TestLazy: UnmarshalJSON had error: %s", err)
+	}
+
+	tests := []struct {
+		desc    string
+		use     func(d Directory) error
+		options []EncodeOption
+	}{
+		{desc: "not used", use: func(d Directory) error { return nil }},
+		{desc: "not used, indented", use: func(d Directory) error { return nil }, options: []EncodeOption{WithIndent("", "  ")}},
+		{desc: "not used, sorted", use: func(d Directory) error { return nil }, options: []EncodeOption{WithSortKeys()}},
+		{
+			desc: "part used, indented",
+			use: func(d Directory) error {
+				_, err := d.GetFile("user/bob/email")
+				return err
+			},
+			options: []EncodeOption{WithIndent("> ", "\t"), WithTrailingNewline()},
+		},
+		{
+			desc: "all used",
+			use: func(d Directory) error {
+				_, err := d.GetFile("items/0/price")
+				if err != nil {
+					return err
+				}
+				_, err = d.GetFile("user/sue/email/work")
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		d, err := UnmarshalJSON(strings.NewReader(text), WithLazy())
+		if err != nil {
+			t.Errorf("TestLazy(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if err := test.use(d); err != nil {
+			t.Errorf("TestLazy(%s): using the Directory had error: %s", test.desc, err)
+			continue
+		}
+
+		got, want := &bytes.Buffer{}, &bytes.Buffer{}
+		if err := MarshalJSON(got, d, test.options...); err != nil {
+			t.Errorf("TestLazy(%s): MarshalJSON had error: %s", test.desc, err)
+			continue
+		}
+		MarshalJSON(want, eager, test.options...)
+		if got.String() != want.String() {
+			t.Errorf("TestLazy(%s): got %s, want %s", test.desc, got, want)
+		}
+	}
+}
+
+func TestLazyLoad(t *testing.T) {
+	d, err := UnmarshalJSON(strings.NewReader(`{"a": {"b": {"c": 1}}, "d": [1, 2]}`), WithLazy())
+	if err != nil {
+		t.Fatalf("TestLazyLoad: got err == %s, want err == nil", err)
+	}
+
+	a, err := d.GetDir("a")
+	if err != nil {
+		t.Fatalf("TestLazyLoad: GetDir(a) had error: %s", err)
+	}
+	if a.lazy.data() == nil {
+		t.Errorf("TestLazyLoad: a was parsed before it was used")
+	}
+	if a.Len() != 1 || a.lazy.data() != nil {
+		t.Errorf("TestLazyLoad: a.Len(): got %d, want 1 and a parsed", a.Len())
+	}
+	b := a.objs["b"].Dir
+	if b.lazy.data() == nil {
+		t.Errorf("TestLazyLoad: a/b was parsed before it was used")
+	}
+
+	// A copy shares what is parsed.
+	d2, err := d.GetDir("d")
+	if err != nil {
+		t.Fatalf("TestLazyLoad: GetDir(d) had error: %s", err)
+	}
+	d3, _ := d.GetDir("d")
+	if err := Append(d2, MustNewFile("", 3)); err != nil {
+		t.Fatalf("TestLazyLoad: Append had error: %s", err)
+	}
+	if d3.Len() != 3 {
+		t.Errorf("TestLazyLoad: copy of d: got Len() == %d, want 3", d3.Len())
+	}
+
+	// A copy made with CP() does not.
+	c := CP(b)
+	if err := c.Set(MustNewFile("e", true)); err != nil {
+		t.Fatalf("TestLazyLoad: Set had error: %s", err)
+	}
+	if b.Len() != 1 {
+		t.Errorf("TestLazyLoad: CP(a/b) changed a/b, got Len() == %d, want 1", b.Len())
+	}
+
+	// Nor does a copy made after a and a/b were parsed.
+	ca := CP(a)
+	if err := ca.Set(MustNewFile("f", 1)); err != nil {
+		t.Fatalf("TestLazyLoad: Set had error: %s", err)
+	}
+	cb, err := ca.GetDir("b")
+	if err != nil {
+		t.Fatalf("TestLazyLoad: GetDir(b) on CP(a) had error: %s", err)
+	}
+	if err := cb.Set(MustNewFile("g", 1)); err != nil {
+		t.Fatalf("TestLazyLoad: Set had error: %s", err)
+	}
+	if a.Len() != 1 || b.Len() != 1 {
+		t.Errorf("TestLazyLoad: CP(a) after parsing changed a or a/b, got Len() == %d and %d, want 1 and 1", a.Len(), b.Len())
+	}
+
+	f, err := NewMemFS(d).ReadFile("a/b/c")
+	if err != nil || string(f) != "1" {
+		t.Errorf("TestLazyLoad(MemFS): got %s, %v, want 1, nil", f, err)
+	}
+
+	buff := &bytes.Buffer{}
+	if err := MarshalJSON(buff, d); err != nil {
+		t.Fatalf("TestLazyLoad: MarshalJSON had error: %s", err)
+	}
+	if want := `{"a":{"b":{"c":1}},"d":[1,2,3]}`; buff.String() != want {
+		t.Errorf("TestLazyLoad: got %s, want %s", buff, want)
+	}
+}
+
+func TestLazyErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		options []DecodeOption
+	}{
+		{desc: "bad number", input: `{"a": {"b": [1, 01]}}`},
+		{desc: "truncated", input: `{"a": {"b": [1, 2`},
+		{desc: "not an object or array", input: `"a"`},
+		{desc: "too deep", input: `{"a": [[[[1]]]]}`, options: []DecodeOption{WithLimits(Limits{MaxDepth: 3})}},
+	}
+	for _, test := range tests {
+		options := append([]DecodeOption{WithLazy()}, test.options...)
+		if _, err := UnmarshalJSON(strings.NewReader(test.input), options...); err == nil {
+			t.Errorf("TestLazyErrors(%s): got err == nil, want err != nil", test.desc)
+		}
+	}
+
+	// Repeated keys are found when the object is used.
+	const input = "{\"a\": 1,\n \"b\": {\"c\": 1, \"c\": 2}}"
+	d, err := UnmarshalJSON(strings.NewReader(input), WithLazy())
+	if err != nil {
+		t.Fatalf("TestLazyErrors(repeated key): got err == %s, want err == nil", err)
+	}
+	if _, err := d.GetFile("a"); err != nil {
+		t.Errorf("TestLazyErrors(repeated key): GetFile(a): got err == %s, want err == nil", err)
+	}
+	_, err = d.GetFile("b/c")
+	var se *SyntaxError
+	if !errors.As(err, &se) {
+		t.Fatalf("TestLazyErrors(repeated key): GetFile(b/c): got err == %v, want *SyntaxError", err)
+	}
+	if se.Line != 2 || se.Path != "/b/c" {
+		t.Errorf("TestLazyErrors(repeated key): got line %d path %q, want line 2 path %q", se.Line, se.Path, "/b/c")
+	}
+	b, _ := d.GetDir("b")
+	if _, err := b.ReadDir(-1); err == nil {
+		t.Errorf("TestLazyErrors(repeated key): ReadDir: got err == nil, want err != nil")
+	}
+	if err := MarshalJSON(&bytes.Buffer{}, d); err == nil {
+		t.Errorf("TestLazyErrors(repeated key): MarshalJSON: got err == nil, want err != nil")
+	}
+}
+
+// endlessReader returns c forever.
+type endlessReader byte
+
+func (e endlessReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = byte(e)
+	}
+	return len(b), nil
+}
+
+func TestLazyMaxBytes(t *testing.T) {
+	limits := WithLimits(Limits{MaxBytes: 100})
+	if _, err := UnmarshalJSON(strings.NewReader(" \n "+`{"a": [1, 2]}`+"\n"), WithLazy(), limits); err != nil {
+		t.Errorf("TestLazyMaxBytes(small): got err == %s, want err == nil", err)
+	}
+
+	// Only what the limit allows is read, or this would never return.
+	r := io.MultiReader(strings.NewReader("\n\n  {\"a\": \""), endlessReader('x'))
+	_, err := UnmarshalJSON(r, WithLazy(), limits)
+	var lErr *LimitError
+	if !errors.As(err, &lErr) {
+		t.Fatalf("TestLazyMaxBytes(endless): got err == %v, want *LimitError", err)
+	}
+	if lErr.Limit != "MaxBytes" || lErr.Max != 100 || lErr.Offset != 105 || lErr.Line != 3 {
+		t.Errorf("TestLazyMaxBytes(endless): got %+v, want MaxBytes of 100 at offset 105 on line 3", lErr)
+	}
+}
+
+func BenchmarkLazyUnmarshalLarge(b *testing.B) {
+	r := strings.NewReader(largeJSON)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		r.Reset(largeJSON)
+		b.StartTimer()
+
+		_, err := UnmarshalJSON(r, WithLazy())
+		if err != nil {
+			panic(err)
+		}
+	}
+}
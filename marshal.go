@@ -2,7 +2,9 @@ package jsonfs
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"reflect"
 	"sync"
 )
 
@@ -12,21 +14,175 @@ var writerPool = sync.Pool{
 	},
 }
 
-// MarshalJSON takes a Directory and outputs it as JSON to a file writer.
-func MarshalJSON(w io.Writer, d Directory) error {
-	var b *bufio.Writer
-	if _, ok := w.(*bufio.Writer); ok {
-		b = w.(*bufio.Writer)
-	} else {
-		b = writerPool.Get().(*bufio.Writer)
-		b.Reset(w)
+// EncodeOption is an optional argument to MarshalJSON() and NewEncoder().
+type EncodeOption func(o *encodeOptions)
+
+type encodeOptions struct {
+	htmlSafe        bool
+	canonical       bool
+	prefix, indent  string
+	sortKeys        bool
+	compactArrays   int
+	trailingNewline bool
+
+	// depth is the nesting depth of the value being encoded, used for indenting.
+	depth int
+}
+
+// newEncodeOptions applies options to the default encodeOptions.
+func newEncodeOptions(options []EncodeOption) encodeOptions {
+	if len(options) == 0 {
+		return encodeOptions{} // opts below is on the heap, as options get a pointer to it.
+	}
+	opts := encodeOptions{}
+	for _, o := range options {
+		o(&opts)
+	}
+	if opts.canonical {
+		opts.htmlSafe = false
+		opts.prefix, opts.indent = "", ""
+		opts.sortKeys = false
+	}
+	return opts
+}
+
+// pretty reports if the output is indented.
+func (o encodeOptions) pretty() bool {
+	return o.indent != "" || o.prefix != ""
+}
+
+// WithHTMLSafe causes <, >, & and the characters U+2028 and U+2029 in strings
+// to be written as \u escape sequences. This makes the output safe to embed
+// inside HTML <script> tags, which is the default for encoding/json.
+func WithHTMLSafe() EncodeOption {
+	return func(o *encodeOptions) {
+		o.htmlSafe = true
+	}
+}
+
+// WithIndent causes each element of an object or array to be written on a new
+// line that starts with prefix followed by one copy of indent for each level
+// of nesting. This works like json.MarshalIndent().
+func WithIndent(prefix, indent string) EncodeOption {
+	return func(o *encodeOptions) {
+		o.prefix = prefix
+		o.indent = indent
+	}
+}
+
+// WithSortKeys causes object keys to be written sorted by name instead of in
+// the order they were added to the Directory.
+func WithSortKeys() EncodeOption {
+	return func(o *encodeOptions) {
+		o.sortKeys = true
+	}
+}
+
+// WithCompactArrays causes arrays with n or fewer elements that only hold
+// basic values, not objects or arrays, to be written on a single line. This
+// is only used with WithIndent().
+func WithCompactArrays(n int) EncodeOption {
+	return func(o *encodeOptions) {
+		o.compactArrays = n
+	}
+}
+
+// WithTrailingNewline causes a newline to be written after the value.
+func WithTrailingNewline() EncodeOption {
+	return func(o *encodeOptions) {
+		o.trailingNewline = true
 	}
-	defer func() { writerPool.Put(b) }()
+}
+
+// MarshalJSON takes a Directory or File and outputs it as JSON to a file writer.
+// A Directory is written as a JSON object or array and a File as a single
+// JSON value.
+func MarshalJSON(w io.Writer, v FileOrDir, options ...EncodeOption) error {
+	return encode(w, v, newEncodeOptions(options))
+}
+
+// Encoder writes JSON values to an io.Writer. This is useful when you write
+// many values with the same options.
+type Encoder struct {
+	w    io.Writer
+	opts encodeOptions
+}
+
+// NewEncoder creates a new Encoder that writes to w.
+func NewEncoder(w io.Writer, options ...EncodeOption) *Encoder {
+	return &Encoder{w: w, opts: newEncodeOptions(options)}
+}
+
+// Encode writes v, which must be a Directory or File, to the Encoder's io.Writer.
+func (e *Encoder) Encode(v FileOrDir) error {
+	return encode(e.w, v, e.opts)
+}
+
+// bufioWriter returns w as a *bufio.Writer. If w is not a *bufio.Writer, one
+// from the writerPool is used and putWriter(b, w) returns it to the pool.
+func bufioWriter(w io.Writer) *bufio.Writer {
+	if b, ok := w.(*bufio.Writer); ok {
+		return b
+	}
+	b := writerPool.Get().(*bufio.Writer)
+	b.Reset(w)
+	return b
+}
 
-	err := d.EncodeJSON(b)
-	if err != nil {
+// putWriter returns b, which bufioWriter(w) returned, to the writerPool if it
+// was taken from there.
+func putWriter(b *bufio.Writer, w io.Writer) {
+	if b == w {
+		return
+	}
+	b.Reset(nil)
+	writerPool.Put(b)
+}
+
+// encode writes v to w.
+func encode(w io.Writer, v FileOrDir, opts encodeOptions) error {
+	b := bufioWriter(w)
+	defer putWriter(b, w)
+
+	switch x := v.(type) {
+	case Directory:
+		if err := x.encodeJSON(b, opts); err != nil {
+			return err
+		}
+	case File:
+		if err := x.encodeJSON(b, opts); err != nil {
+			return err
+		}
+	default:
+		// reflect.TypeOf() keeps v from escaping, so passing a Directory does not allocate.
+		return fmt.Errorf("%v is not a supported type", reflect.TypeOf(v))
+	}
+	if opts.trailingNewline {
+		if err := WriteOut(b, '\n'); err != nil {
+			return err
+		}
+	}
+	return b.Flush()
+}
+
+// writeIndent starts a new line indented for opts.depth.
+func writeIndent(w io.Writer, opts encodeOptions) error {
+	if err := WriteOut(w, '\n'); err != nil {
 		return err
 	}
-	err = b.Flush()
-	return err
+	// UnsafeGetBytes() cannot handle an empty string.
+	if opts.prefix != "" {
+		if err := WriteOut(w, opts.prefix); err != nil {
+			return err
+		}
+	}
+	if opts.indent == "" {
+		return nil
+	}
+	for i := 0; i < opts.depth; i++ {
+		if err := WriteOut(w, opts.indent); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -42,6 +42,135 @@ func TestMarshalJSON(t *testing.T) {
 	}
 }
 
+func TestMarshalJSONEscapes(t *testing.T) {
+	const text = `{"a\"b":"line\nbreak \u00e9 \ud83d\ude00 \/ tab\t","ctl":"\u0001","lone":"\ud800x","html":"<a&b>"}`
+
+	d, err := UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("TestMarshalJSONEscapes: UnmarshalJSON had error: %s", err)
+	}
+
+	want := map[string]string{
+		`a"b`:  "line\nbreak \u00e9 \U0001F600 / tab\t",
+		"ctl":  "\x01",
+		"lone": "\uFFFDx",
+		"html": "<a&b>",
+	}
+	for k, v := range want {
+		f, err := d.GetFile(k)
+		if err != nil {
+			t.Fatalf("TestMarshalJSONEscapes(%s): %s", k, err)
+		}
+		if f.StringOrZV() != v {
+			t.Errorf("TestMarshalJSONEscapes(%s): got %q, want %q", k, f.StringOrZV(), v)
+		}
+	}
+
+	buff := &bytes.Buffer{}
+	if err := MarshalJSON(buff, d); err != nil {
+		t.Fatalf("TestMarshalJSONEscapes: MarshalJSON had error: %s", err)
+	}
+	if !json.Valid(buff.Bytes()) {
+		t.Fatalf("TestMarshalJSONEscapes: MarshalJSON output was not valid JSON: %s", buff.String())
+	}
+	if strings.Contains(buff.String(), `\u003c`) {
+		t.Errorf("TestMarshalJSONEscapes: MarshalJSON escaped HTML without WithHTMLSafe(): %s", buff.String())
+	}
+
+	got, err := UnmarshalJSON(buff)
+	if err != nil {
+		t.Fatalf("TestMarshalJSONEscapes: UnmarshalJSON of output had error: %s", err)
+	}
+	for k, v := range want {
+		f, _ := got.GetFile(k)
+		if f.StringOrZV() != v {
+			t.Errorf("TestMarshalJSONEscapes(round trip %s): got %q, want %q", k, f.StringOrZV(), v)
+		}
+	}
+
+	buff.Reset()
+	if err := MarshalJSON(buff, d, WithHTMLSafe()); err != nil {
+		t.Fatalf("TestMarshalJSONEscapes: MarshalJSON(WithHTMLSafe) had error: %s", err)
+	}
+	if !strings.Contains(buff.String(), `"\u003ca\u0026b\u003e"`) {
+		t.Errorf("TestMarshalJSONEscapes: MarshalJSON(WithHTMLSafe) did not escape HTML: %s", buff.String())
+	}
+
+	for _, bad := range []string{"{\"a\": \"raw\nnewline\"}", `{"a": "\x"}`, `{"a": "\u12"}`} {
+		if _, err := UnmarshalJSON(strings.NewReader(bad)); err == nil {
+			t.Errorf("TestMarshalJSONEscapes(%q): got err == nil, want err != nil", bad)
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	const text = `{"b":[1,2],"a":{"c":[],"d":{},"e":[{"f":null},"x"]}}`
+
+	d, err := UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("TestEncoder: UnmarshalJSON had error: %s", err)
+	}
+
+	// Without the options that json.Indent() doesn't have, we should match it.
+	want := &bytes.Buffer{}
+	if err := json.Indent(want, []byte(text), ">", "\t"); err != nil {
+		t.Fatalf("TestEncoder: json.Indent had error: %s", err)
+	}
+
+	tests := []struct {
+		desc    string
+		options []EncodeOption
+		want    string
+	}{
+		{desc: "no options", want: text},
+		{desc: "like json.Indent", options: []EncodeOption{WithIndent(">", "\t")}, want: want.String()},
+		{
+			desc:    "sorted with compact arrays and trailing newline",
+			options: []EncodeOption{WithIndent("", "  "), WithSortKeys(), WithCompactArrays(2), WithTrailingNewline()},
+			want: `{
+  "a": {
+    "c": [],
+    "d": {},
+    "e": [
+      {
+        "f": null
+      },
+      "x"
+    ]
+  },
+  "b": [1, 2]
+}
+`,
+		},
+		{desc: "compact arrays too small", options: []EncodeOption{WithIndent("", ""), WithCompactArrays(1)}, want: text},
+		{desc: "canonical ignores indent", options: []EncodeOption{WithIndent("", "  "), WithCanonical()}, want: `{"a":{"c":[],"d":{},"e":[{"f":null},"x"]},"b":[1,2]}`},
+	}
+
+	for _, test := range tests {
+		buff := &bytes.Buffer{}
+		enc := NewEncoder(buff, test.options...)
+		if err := enc.Encode(d); err != nil {
+			t.Errorf("TestEncoder(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestEncoder(%s): got\n%s\nwant\n%s", test.desc, buff.String(), test.want)
+		}
+	}
+
+	// An Encoder can write many values.
+	buff := &bytes.Buffer{}
+	enc := NewEncoder(buff, WithTrailingNewline())
+	for _, v := range []FileOrDir{MustNewFile("", 1), MustNewArray("", MustNewFile("", "a"))} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("TestEncoder(many values): got err == %s, want err == nil", err)
+		}
+	}
+	if buff.String() != "1\n[\"a\"]\n" {
+		t.Errorf("TestEncoder(many values): got %q, want %q", buff.String(), "1\n[\"a\"]\n")
+	}
+}
+
 func BenchmarkMarshalJSONSmall(b *testing.B) {
 	d, err := UnmarshalJSON(strings.NewReader(jsonText))
 	if err != nil {
@@ -80,6 +209,26 @@ func BenchmarkMarshalJSONLarge(b *testing.B) {
 	}
 }
 
+func BenchmarkEncoderIndentLarge(b *testing.B) {
+	d, err := UnmarshalJSON(strings.NewReader(largeJSON))
+	if err != nil {
+		panic(err)
+	}
+	file := &bytes.Buffer{}
+	enc := NewEncoder(file, WithIndent("", "\t"), WithCompactArrays(5))
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		file.Reset()
+		b.StartTimer()
+		if err := enc.Encode(d); err != nil {
+			panic(err)
+		}
+	}
+}
+
 func BenchmarkMarshalJSONStdlibSmall(b *testing.B) {
 	m := map[string]any{}
 	if err := json.Unmarshal(UnsafeGetBytes(jsonText), &m); err != nil {
@@ -127,3 +276,51 @@ func BenchmarkMarshalJSONStdlibLarge(b *testing.B) {
 		}
 	}
 }
+
+func TestMarshalCanonical(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "RFC 8785 section 3.2.2",
+			input: `{"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001], "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/", "literals": [null, true, false]}`,
+			want:  `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			desc:  "RFC 8785 section 3.2.3 key sorting",
+			input: `{"\u20ac": 1, "\r": 2, "\ufb33": 3, "1": 4, "\ud83d\ude00": 5, "\u0080": 6, "\u00f6": 7}`,
+			want:  "{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001F600\":5,\"\ufb33\":3}",
+		},
+		{
+			desc:  "numbers",
+			input: `[0, -0, 5e-324, 1.7976931348623157e308, 9007199254740992, 295147905179352830000, 1e21, 0.000001, 1e-7, -1.5, 100, 123456789012345678901234567890]`,
+			want:  `[0,0,5e-324,1.7976931348623157e+308,9007199254740992,295147905179352830000,1e+21,0.000001,1e-7,-1.5,100,1.2345678901234568e+29]`,
+		},
+		{
+			desc:  "no html escaping",
+			input: `{"b": "<&>", "a": {"d": [], "c": {}}}`,
+			want:  `{"a":{"c":{},"d":[]},"b":"<&>"}`,
+		},
+	}
+
+	for _, test := range tests {
+		v, err := UnmarshalValue(strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("TestMarshalCanonical(%s): UnmarshalValue had error: %s", test.desc, err)
+		}
+		buff := &bytes.Buffer{}
+		if err := MarshalCanonical(buff, v); err != nil {
+			t.Errorf("TestMarshalCanonical(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestMarshalCanonical(%s): got %s, want %s", test.desc, buff.String(), test.want)
+		}
+	}
+
+	if err := MarshalCanonical(&bytes.Buffer{}, MustNewFile("big", json.Number("1e400"))); err == nil {
+		t.Errorf("TestMarshalCanonical(1e400): got err == nil, want err != nil")
+	}
+}
@@ -45,6 +45,9 @@ func (f MemFS) Open(name string) (fs.File, error) {
 	}
 
 	for i := 0; i < len(p)-1; i++ {
+		if err := d.load(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
 		v, ok := d.objs[p[i]]
 		if !ok || v.Type != OTDir {
 			return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("could not find directory %q", strings.Join(p, "/"))}
@@ -52,6 +55,9 @@ func (f MemFS) Open(name string) (fs.File, error) {
 		d = v.Dir
 	}
 	fn := p[len(p)-1]
+	if err := d.load(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
 	v, ok := d.objs[fn]
 	if !ok {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("could not find file %q", "/"+name)}
@@ -83,7 +89,7 @@ func (m MemFS) OpenFile(name string, perms fs.FileMode, options ...gopherfs.OFOp
 		dirName, fileName := path.Split(name)
 		if dirName == "" { // They want to create a directory at the root
 			d, _ := NewDir(fileName) // Cannot error, as we are not passing contents
-			m.root.objs[fileName] = Object{Type: OTDir, Dir: d}
+			m.root.setObj(fileName, Object{Type: OTDir, Dir: d})
 			return d, nil
 		}
 
@@ -100,7 +106,7 @@ func (m MemFS) OpenFile(name string, perms fs.FileMode, options ...gopherfs.OFOp
 		}
 
 		dir, _ := NewDir(fileName)
-		d.objs[fileName] = Object{Type: OTDir, Dir: dir}
+		d.setObj(fileName, Object{Type: OTDir, Dir: dir})
 		return dir, nil
 	}
 
@@ -206,6 +212,9 @@ func (f MemFS) MkdirAll(p string, perm fs.FileMode) error {
 
 	d := *f.root
 	for i := 0; i < len(sp)-1; i++ {
+		if err := d.load(); err != nil {
+			return &fs.PathError{Op: "mkdirall", Path: p, Err: err}
+		}
 		o, ok := d.objs[sp[i]]
 		if ok {
 			if o.Type == OTFile {
@@ -214,8 +223,8 @@ func (f MemFS) MkdirAll(p string, perm fs.FileMode) error {
 			d = o.Dir
 			continue
 		}
-		dir := Directory{name: sp[i], modTime: time.Now()}
-		d.objs[sp[i]] = Object{Type: OTDir, Dir: dir}
+		dir := newDir(sp[i], time.Now())
+		d.setObj(sp[i], Object{Type: OTDir, Dir: dir})
 		d = dir
 	}
 	return nil
@@ -278,6 +287,9 @@ func (f MemFS) remove(name string, children bool) error {
 
 	d := *f.root
 	for i := 0; i < len(p)-1; i++ {
+		if err := d.load(); err != nil {
+			return &fs.PathError{Op: "remove", Path: name, Err: err}
+		}
 		o, ok := d.objs[p[i]]
 		if !ok {
 			return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("could not find directory %q", strings.Join(p, "/"))}
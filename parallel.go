@@ -0,0 +1,349 @@
+package jsonfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// WithWorkers sets how many goroutines decode values for
+// UnmarshalStreamParallel() and UnmarshalArrayStreamParallel(). The default is
+// runtime.GOMAXPROCS(0).
+func WithWorkers(n int) DecodeOption {
+	return func(o *decodeOptions) {
+		o.workers = n
+	}
+}
+
+// WithUnordered causes UnmarshalStreamParallel() and
+// UnmarshalArrayStreamParallel() to send each value as soon as it is decoded,
+// instead of in the order they are in the input. Stream.Index says where each
+// value was. This keeps a slow value from holding up the ones after it.
+func WithUnordered() DecodeOption {
+	return func(o *decodeOptions) {
+		o.unordered = true
+	}
+}
+
+// WithBuffer sets how many values UnmarshalStreamParallel() and
+// UnmarshalArrayStreamParallel() may read ahead of the receiver. When that
+// many are waiting, reading the input stops until the receiver catches up,
+// which bounds the memory used. The default is 4 times the number of workers.
+func WithBuffer(n int) DecodeOption {
+	return func(o *decodeOptions) {
+		o.buffer = n
+	}
+}
+
+// UnmarshalStreamParallel is like UnmarshalStream(), but decodes many values
+// at the same time. One goroutine finds where each value starts and ends and
+// the values are decoded by the workers from WithWorkers(). Values are sent in
+// the order they are in the input unless WithUnordered() is used.
+//
+// With more than a couple of CPUs, this is faster than UnmarshalStream() for
+// inputs with many values, like NDJSON logs. With one CPU it is slower. If a
+// value has an error, it is sent after the values before it and the channel is
+// closed. With WithUnordered(), values after it may have been sent.
+// Cancellation and WithSkipErrors() work the same as UnmarshalStream().
+// WithDuplicateReport() functions may be called from many goroutines at once.
+func UnmarshalStreamParallel(ctx context.Context, r io.Reader, options ...DecodeOption) chan Stream {
+	return unmarshalParallel(ctx, r, newDecodeOptions(options), splitValues)
+}
+
+// UnmarshalArrayStreamParallel is like UnmarshalArrayStream(), but decodes
+// many elements of the array at the same time, the same as
+// UnmarshalStreamParallel().
+func UnmarshalArrayStreamParallel(ctx context.Context, r io.Reader, options ...DecodeOption) chan Stream {
+	opts := newDecodeOptions(options)
+	opts.skipErrors, opts.summary = false, nil // Only for streams of values.
+	return unmarshalParallel(ctx, r, opts, splitArray)
+}
+
+// parallelJob is a value found by a splitFunc for a worker to decode.
+type parallelJob struct {
+	// index is the position of the value in the input and name is the name it
+	// is decoded with.
+	index int
+	name  string
+	// data is the JSON of the value, which is size bytes, followed by up to
+	// excerptLen bytes of the input after it for the excerpts in errors. The
+	// decoded value may point into it.
+	data []byte
+	size int
+	// offset, line and lineStart are the decoder's position at the start of
+	// data and before is the input before it, so that errors point at the
+	// right place.
+	offset    int64
+	line      int
+	lineStart int64
+	before    []byte
+
+	// err is set if the input had an error instead of a value.
+	err error
+	// result gets the decoded value when the values are sent in order.
+	result chan Stream
+}
+
+// splitFunc reads the values in d, calling emit with each one. It stops if
+// emit returns false. It returns an error if the input is not valid.
+type splitFunc func(ctx context.Context, d *decoder, emit func(*parallelJob) bool) error
+
+// unmarshalParallel splits the input from r into values with split, decodes
+// them with workers and sends them on the returned channel.
+func unmarshalParallel(ctx context.Context, r io.Reader, opts decodeOptions, split splitFunc) chan Stream {
+	workers := opts.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	buffer := opts.buffer
+	if buffer <= 0 {
+		buffer = 4 * workers
+	}
+
+	ch := make(chan Stream, 1)
+	// This is canceled to stop everything after an error.
+	ctx, cancel := context.WithCancel(ctx)
+
+	jobs := make(chan *parallelJob, buffer)
+	// order holds the jobs in input order when values are sent in order. As
+	// it is bounded, it also limits how far ahead of the receiver we get.
+	var order chan *parallelJob
+	if !opts.unordered {
+		order = make(chan *parallelJob, buffer)
+	}
+
+	// Splits the input into jobs.
+	go func() {
+		defer close(jobs)
+		if order != nil {
+			defer close(order)
+		}
+
+		// A job is sent to a worker before it is put in order, so every job in
+		// order gets a result.
+		n := 0
+		emit := func(j *parallelJob) bool {
+			n++
+			if order != nil {
+				j.result = make(chan Stream, 1)
+			}
+			select {
+			case jobs <- j:
+			case <-ctx.Done():
+				return false
+			}
+			if order == nil {
+				return true
+			}
+			select {
+			case order <- j:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		d, done := newStreamDecoder(r, opts)
+		defer done()
+
+		if err := split(ctx, d, emit); err != nil {
+			emit(&parallelJob{index: n, err: err})
+		}
+	}()
+
+	// Decodes the jobs. When values are sent in order, the results are sent
+	// by the loop below. Otherwise the workers send them, stopping after an
+	// error.
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped bool
+		sum     StreamSummary
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				s := decodeJob(ctx, opts, j)
+				if order != nil {
+					j.result <- s
+					continue
+				}
+
+				mu.Lock()
+				if !stopped && !sum.send(ctx, ch, s) {
+					stopped = true
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ch)
+		defer cancel()
+
+		if order == nil {
+			wg.Wait()
+			sum.save(opts.summary)
+			return
+		}
+		defer sum.save(opts.summary)
+		for j := range order {
+			if !sum.send(ctx, ch, <-j.result) {
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// send sends s on ch and counts it in sum. It reports if the stream goes on,
+// which is if s was sent and is a value or a *RecordError.
+func (sum *StreamSummary) send(ctx context.Context, ch chan Stream, s Stream) bool {
+	if !sendStream(ctx, ch, s) {
+		return false
+	}
+	switch s.Err.(type) {
+	case nil:
+		sum.Decoded++
+	case *RecordError:
+		sum.Skipped++
+	default:
+		return false
+	}
+	return true
+}
+
+// decodeJob decodes the value in j.
+func decodeJob(ctx context.Context, opts decodeOptions, j *parallelJob) Stream {
+	if j.err != nil {
+		s := Stream{Index: j.index, Err: j.err}
+		if _, ok := j.err.(*RecordError); ok {
+			s.Start, s.End = j.offset, j.offset+int64(j.size)
+		}
+		return s
+	}
+
+	r := bytes.NewReader(j.data)
+	b := bufioReader(r)
+	defer putReader(b, r)
+	d := newDecoder(b, opts)
+	defer d.close()
+	d.input, d.inputStart = j.data, j.offset
+	d.seek(j.offset, j.line, j.lineStart, j.before)
+	if j.name != "" {
+		d.pushPath(j.name)
+	}
+
+	d.startValue()
+	v, err := decodeValue(ctx, d, j.name)
+	if err != nil {
+		err = d.syntaxError(err)
+		if !d.skippable(err) {
+			return Stream{Index: j.index, Err: err}
+		}
+		err = &RecordError{Offset: j.offset, Line: j.line, Raw: j.data[:j.size:j.size], Err: err}
+		return Stream{Index: j.index, Err: err, Start: j.offset, End: j.offset + int64(j.size)}
+	}
+	return newStream(v, j.index, j.offset, j.offset+int64(j.size))
+}
+
+// nextJob reads the value that is next in d and returns a job to decode it.
+// size is how large the value is likely to be. If there is an error, the job's
+// data is what was read of the value.
+func nextJob(ctx context.Context, d *decoder, index int, name string, size int) (*parallelJob, error) {
+	j := &parallelJob{
+		index:     index,
+		name:      name,
+		offset:    d.offset,
+		line:      d.line,
+		lineStart: d.lineStart,
+		before:    d.recentBytes(),
+	}
+	d.capturing, d.capture = true, make([]byte, 0, size)
+	err := skipValue(d)
+	j.data, j.size = d.capture, len(d.capture)
+	d.capturing, d.capture = false, nil
+	if err != nil {
+		return j, j.valueError(ctx, d, d.syntaxError(err))
+	}
+	j.data = append(j.data, d.peekBuffered(excerptLen)...)
+	return j, nil
+}
+
+// valueError returns the error for the value in j, which skipValue() found
+// err in. skipValue() gives the same syntax errors as decoding, but does not
+// track the path in the value or check repeated keys, which decoding may find
+// first. So the value is decoded from j.data and the input that is buffered
+// in d to give the same error as UnmarshalStream(). err is returned if that
+// does not find an error.
+func (j *parallelJob) valueError(ctx context.Context, d *decoder, err error) error {
+	if d.readErr != nil {
+		return d.readErr
+	}
+
+	buffered := d.peekBuffered(d.b.Buffered())
+	r := io.MultiReader(bytes.NewReader(j.data), bytes.NewReader(buffered))
+	b := bufioReader(r)
+	defer putReader(b, r)
+	dec := newDecoder(b, d.opts)
+	defer dec.close()
+	dec.seek(j.offset, j.line, j.lineStart, j.before)
+	dec.path = append(dec.path, d.path...)
+
+	dec.startValue()
+	if _, vErr := decodeValue(ctx, dec, j.name); vErr != nil {
+		return dec.syntaxError(vErr)
+	}
+	return err
+}
+
+// splitValues is a splitFunc for a stream of values, like UnmarshalStream().
+func splitValues(ctx context.Context, d *decoder, emit func(*parallelJob) bool) error {
+	size := 0
+	for i := 0; ; i++ {
+		if err := checkCtx(ctx); err != nil {
+			return err
+		}
+
+		d.startValue()
+		if _, err := d.Peek(1); err == io.EOF {
+			return nil
+		}
+		j, err := nextJob(ctx, d, i, "", size)
+		if err != nil {
+			if !d.skippable(err) {
+				return err
+			}
+			err = d.skipRecord(j.offset, j.line, j.data, err)
+			if _, ok := err.(*RecordError); !ok {
+				return err
+			}
+			j = &parallelJob{index: i, offset: j.offset, size: int(d.offset - j.offset), err: err}
+		}
+		size = len(j.data)
+		if !emit(j) {
+			return nil
+		}
+	}
+}
+
+// splitArray is a splitFunc for the elements of an array, like
+// UnmarshalArrayStream().
+func splitArray(ctx context.Context, d *decoder, emit func(*parallelJob) bool) error {
+	size := 0
+	_, err := eachElement(ctx, d, func(i int, name string) (bool, error) {
+		j, err := nextJob(ctx, d, i, name, size)
+		if err != nil {
+			return false, err
+		}
+		size = len(j.data)
+		return emit(j), nil
+	})
+	return err
+}
@@ -0,0 +1,168 @@
+package jsonfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// indexedOutput marshals every value in the stream and returns them by
+// Stream.Index, with "err: " and the error for an error.
+func indexedOutput(ch chan Stream) map[int]string {
+	got := map[int]string{}
+	for s := range ch {
+		if s.Err != nil {
+			got[s.Index] = "err: " + s.Err.Error()
+			continue
+		}
+		buff := &bytes.Buffer{}
+		if err := MarshalJSON(buff, s.Value); err != nil {
+			got[s.Index] = "err: " + err.Error()
+			continue
+		}
+		got[s.Index] = buff.String()
+	}
+	return got
+}
+
+func TestUnmarshalParallel(t *testing.T) {
+	var ndjson, array strings.Builder
+	array.WriteString("[\n")
+	for i := 0; i < 500; i++ {
+		record := fmt.Sprintf(`{"id": %d, "name": "useré%d", "tags": ["a", %d.5, null], "nested": {"ok": %t}}`, i, i, i, i%2 == 0)
+		ndjson.WriteString(record + "\n")
+		if i > 0 {
+			array.WriteString(",\n")
+		}
+		array.WriteString(record)
+	}
+	array.WriteString("\n]")
+
+	tests := []struct {
+		desc  string
+		input string
+		array bool
+	}{
+		{desc: "ndjson", input: ndjson.String()},
+		{desc: "concatenated values of any type", input: `{"a":1}[1,2]"str" 3 true null{}`},
+		{desc: "empty input", input: " \n "},
+		{desc: "syntax error", input: "{\"a\": 1}\n{\"b\": 2}\n{\"a\": }\n{\"c\": 3}"},
+		{desc: "repeated key", input: "{\"a\": 1}\n\n  {\"b\": 2, \"b\": 3}\n{\"c\": 3}"},
+		{desc: "large array", input: array.String(), array: true},
+		{desc: "mixed array", input: ` [ {"a": 1}, [], "s", 2.5, {} ] `, array: true},
+		{desc: "empty array", input: `[]`, array: true},
+		{desc: "not an array", input: `{"a": 1}`, array: true},
+		{desc: "truncated array", input: `[{"a": 1}, {"a": 2}`, array: true},
+		{desc: "bad element", input: "[{}, {\"a\": [tru]}, 3]", array: true},
+		{desc: "missing comma", input: "[{}, 1\n 2]", array: true},
+	}
+
+	for _, test := range tests {
+		stream, parallel := UnmarshalStream, UnmarshalStreamParallel
+		if test.array {
+			stream, parallel = UnmarshalArrayStream, UnmarshalArrayStreamParallel
+		}
+		want := indexedOutput(stream(context.Background(), strings.NewReader(test.input)))
+
+		for _, workers := range []int{1, 4} {
+			options := []DecodeOption{WithWorkers(workers), WithBuffer(3)}
+			got := indexedOutput(parallel(context.Background(), strings.NewReader(test.input), options...))
+			if diff := pretty.Compare(want, got); diff != "" {
+				t.Errorf("TestUnmarshalParallel(%s, %d workers): -want/+got:\n%s", test.desc, workers, diff)
+			}
+
+			// Without an error, the same values arrive in any order.
+			var failed bool
+			for _, v := range want {
+				failed = failed || strings.HasPrefix(v, "err: ")
+			}
+			if failed {
+				continue
+			}
+			options = append(options, WithUnordered())
+			got = indexedOutput(parallel(context.Background(), strings.NewReader(test.input), options...))
+			if diff := pretty.Compare(want, got); diff != "" {
+				t.Errorf("TestUnmarshalParallel(%s, %d workers, unordered): -want/+got:\n%s", test.desc, workers, diff)
+			}
+		}
+	}
+}
+
+func TestUnmarshalParallelOrder(t *testing.T) {
+	var input strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&input, "%d\n", i)
+	}
+
+	var got []int
+	for s := range UnmarshalStreamParallel(context.Background(), strings.NewReader(input.String()), WithWorkers(8)) {
+		if s.Err != nil {
+			t.Fatalf("TestUnmarshalParallelOrder: got err == %s, want err == nil", s.Err)
+		}
+		got = append(got, s.Index)
+		if f := s.Value.(File); f.IntOrZV() != int64(s.Index) {
+			t.Fatalf("TestUnmarshalParallelOrder: value %d had Index %d", f.IntOrZV(), s.Index)
+		}
+	}
+	if len(got) != 1000 || !sort.IntsAreSorted(got) {
+		t.Errorf("TestUnmarshalParallelOrder: got %d values in order %v, want 1000 values in input order", len(got), sort.IntsAreSorted(got))
+	}
+}
+
+func TestUnmarshalParallelCancel(t *testing.T) {
+	input := strings.Repeat(`{"a": [1, 2, 3]}`+"\n", 10000)
+
+	for _, unordered := range []bool{false, true} {
+		ctx, cancel := context.WithCancel(context.Background())
+		options := []DecodeOption{WithWorkers(4), WithBuffer(2)}
+		if unordered {
+			options = append(options, WithUnordered())
+		}
+		ch := UnmarshalStreamParallel(ctx, strings.NewReader(input), options...)
+		<-ch
+		cancel()
+
+		n := 0
+		for range ch {
+			n++
+		}
+		// The buffer limits how far ahead of us the decoding gets.
+		if n > 20 {
+			t.Errorf("TestUnmarshalParallelCancel(unordered %t): got %d values after cancel, want at most 20", unordered, n)
+		}
+	}
+}
+
+func BenchmarkUnmarshalStream(b *testing.B) {
+	benchmarkStream(b, UnmarshalStream)
+}
+
+func BenchmarkUnmarshalStreamParallel(b *testing.B) {
+	benchmarkStream(b, UnmarshalStreamParallel)
+}
+
+func benchmarkStream(b *testing.B, stream func(context.Context, io.Reader, ...DecodeOption) chan Stream) {
+	var buff strings.Builder
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&buff, `{"id": %d, "name": "user%d", "email": "user%d@example.com", "tags": ["a", "b", "c"], "scores": [1.5, 2.5, %d], "address": {"street": "1 Main St", "zip": "%05d"}}`+"\n", i, i, i, i, i)
+	}
+	input := buff.String()
+	r := strings.NewReader(input)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Reset(input)
+		for s := range stream(context.Background(), r) {
+			if s.Err != nil {
+				panic(s.Err)
+			}
+		}
+	}
+}
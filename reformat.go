@@ -0,0 +1,160 @@
+package jsonfs
+
+import (
+	"bufio"
+	"io"
+)
+
+// Reformat copies the JSON in r to w with new whitespace, without building a
+// Directory. With no options the output is minified, use WithIndent() to
+// prettify it. WithHTMLSafe(), WithSortKeys(), WithCompactArrays() and
+// WithCanonical() need the whole value in memory, so they are ignored. Strings
+// and numbers are copied exactly as they are in the input.
+//
+// Memory use does not depend on the size of the input, only on the nesting depth
+// and the size of the largest string. r may hold many JSON values, such as NDJSON,
+// which are written separated by newlines. If the input is not valid JSON, a
+// *SyntaxError is returned, after the output up to the error is written to w.
+func Reformat(w io.Writer, r io.Reader, options ...EncodeOption) error {
+	b := bufioReader(r)
+	defer putReader(b, r)
+	bw := bufioWriter(w)
+	defer putWriter(bw, w)
+
+	d := newDecoder(b, decodeOptions{})
+	defer d.close()
+
+	s := newScanner(d)
+	s.raw = true
+	rf := reformatter{s: s, w: bw, opts: newEncodeOptions(options)}
+	if err := rf.run(); err != nil {
+		bw.Flush() // The error from reading is the one to return.
+		return err
+	}
+	return bw.Flush()
+}
+
+// Validate reads all the JSON values in r and returns a *SyntaxError at the
+// first problem, without building a Directory. Memory use is the same as with
+// Reformat(). Options such as WithLimits() and WithRelaxed() work as they do
+// with UnmarshalJSON(). Repeated object keys are not checked, as they are not
+// a syntax error.
+func Validate(r io.Reader, options ...DecodeOption) error {
+	b := bufioReader(r)
+	defer putReader(b, r)
+
+	d := newDecoder(b, newDecodeOptions(options))
+	defer d.close()
+
+	s := newScanner(d)
+	for i := 0; ; i++ {
+		_, err := s.Next()
+		switch {
+		case err == io.EOF && i == 0:
+			return d.syntaxError(err)
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// reformatter writes the tokens from a Scanner to a writer with new whitespace.
+type reformatter struct {
+	s    *Scanner
+	w    *bufio.Writer
+	opts encodeOptions
+	// base is added to the depth when indenting, for a value written inside
+	// another value.
+	base int
+}
+
+// run reformats every value in the input.
+func (r *reformatter) run() error {
+	// depth is how many objects and arrays we are in. first is set if the
+	// next token is the first in its object or array and afterKey if the next
+	// token is the value of a key.
+	var depth int
+	var first, afterKey bool
+	for values := 0; ; {
+		tok, err := r.s.Next()
+		switch {
+		case err == io.EOF && values == 0:
+			return r.s.d.syntaxError(err)
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+
+		// Write what goes between the last token and this one.
+		switch {
+		case tok.Kind == TokenEndObject || tok.Kind == TokenEndArray:
+			depth--
+			if !first {
+				r.newline(depth)
+			}
+			first = false
+		case afterKey:
+			afterKey = false
+		case depth == 0:
+			if values > 0 && !r.opts.trailingNewline {
+				r.w.WriteByte('\n')
+			}
+			values++
+		default:
+			if !first {
+				r.w.WriteByte(comma)
+			}
+			first = false
+			r.newline(depth)
+		}
+
+		switch tok.Kind {
+		case TokenBeginObject:
+			r.w.WriteByte(openBrace)
+			depth++
+			first = true
+		case TokenBeginArray:
+			r.w.WriteByte(openBracket)
+			depth++
+			first = true
+		case TokenEndObject:
+			r.w.WriteByte(closeBrace)
+		case TokenEndArray:
+			r.w.WriteByte(closeBracket)
+		case TokenKey:
+			r.w.WriteByte(doubleQuote)
+			r.w.Write(tok.Value)
+			r.w.WriteByte(doubleQuote)
+			r.w.WriteByte(colon)
+			if r.opts.pretty() {
+				r.w.WriteByte(' ')
+			}
+			afterKey = true
+		case TokenString:
+			r.w.WriteByte(doubleQuote)
+			r.w.Write(tok.Value)
+			r.w.WriteByte(doubleQuote)
+		default:
+			r.w.Write(tok.Value)
+		}
+
+		if depth == 0 && r.opts.trailingNewline {
+			r.w.WriteByte('\n')
+		}
+	}
+}
+
+// newline starts a new line indented for depth, if we are indenting.
+func (r *reformatter) newline(depth int) {
+	if !r.opts.pretty() {
+		return
+	}
+	r.w.WriteByte('\n')
+	r.w.WriteString(r.opts.prefix)
+	for i := 0; i < r.base+depth; i++ {
+		r.w.WriteString(r.opts.indent)
+	}
+}
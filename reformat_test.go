@@ -0,0 +1,122 @@
+package jsonfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReformat(t *testing.T) {
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, []byte(jsonText), ">", "\t"); err != nil {
+		t.Fatalf("TestReformat: json.Indent had error: %s", err)
+	}
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, []byte(largeJSON)); err != nil {
+		t.Fatalf("TestReformat: json.Compact had error: %s", err)
+	}
+	smallCompacted := &bytes.Buffer{}
+	if err := json.Compact(smallCompacted, []byte(jsonText)); err != nil {
+		t.Fatalf("TestReformat: json.Compact had error: %s", err)
+	}
+
+	tests := []struct {
+		desc    string
+		input   string
+		options []EncodeOption
+		want    string
+	}{
+		{desc: "minify", input: jsonText, want: smallCompacted.String()},
+		{desc: "minify large", input: largeJSON, want: compacted.String()},
+		// json.Indent() keeps the trailing whitespace, which we don't.
+		{desc: "prettify", input: jsonText, options: []EncodeOption{WithIndent(">", "\t")}, want: strings.TrimRight(indented.String(), " \n")},
+		{desc: "escapes are kept", input: `["é\n", "\"", {"\/": -1.50E+3}]`, want: `["é\n","\"",{"\/":-1.50E+3}]`},
+		{desc: "many values", input: "{\"a\": 1}\n\n[1, 2]  3", want: "{\"a\":1}\n[1,2]\n3"},
+		{desc: "trailing newline", input: "{\"a\": 1} [ ]", options: []EncodeOption{WithTrailingNewline()}, want: "{\"a\":1}\n[]\n"},
+		{desc: "empty", input: `{ "a" : { } , "b" : [ ] }`, options: []EncodeOption{WithIndent("", " ")}, want: "{\n \"a\": {},\n \"b\": []\n}"},
+	}
+
+	for _, test := range tests {
+		buff := &bytes.Buffer{}
+		if err := Reformat(buff, strings.NewReader(test.input), test.options...); err != nil {
+			t.Errorf("TestReformat(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestReformat(%s): got\n%s\nwant\n%s", test.desc, buff.String(), test.want)
+		}
+	}
+
+	// The output before an error is written.
+	buff := &bytes.Buffer{}
+	err := Reformat(buff, strings.NewReader("{\"a\": [1, 2]}\n{\"b\": x}"))
+	var sErr *SyntaxError
+	if !errors.As(err, &sErr) {
+		t.Errorf("TestReformat(error): got err == %v, want *SyntaxError", err)
+	}
+	if want := "{\"a\":[1,2]}\n{\"b\":"; buff.String() != want {
+		t.Errorf("TestReformat(error): got %q, want %q", buff.String(), want)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		options []DecodeOption
+		path    string
+		err     bool
+	}{
+		{desc: "large", input: largeJSON},
+		{desc: "many values", input: "{\"a\": 1}\n[1]\n\"s\""},
+		{desc: "empty", input: " ", err: true},
+		{desc: "bad number", input: `{"a": [1, 2, 01]}`, path: "/a/2", err: true},
+		{desc: "bad escape", input: `{"a": {"b": "\x"}}`, path: "/a/b", err: true},
+		{desc: "missing comma", input: `[1 2]`, path: "", err: true},
+		{desc: "missing colon", input: `{"a" 1}`, path: "/a", err: true},
+		{desc: "truncated", input: `{"a": [1, 2`, path: "/a", err: true},
+		{desc: "trailing comma", input: `{"a": [1, 2,],}`, path: "/a/2", err: true},
+		{desc: "relaxed", input: "// config\n{a: [1, 2,], 'b': 0x10,}", options: []DecodeOption{WithRelaxed()}},
+		{desc: "duplicate keys are valid syntax", input: `{"a": 1, "a": 2}`},
+	}
+
+	for _, test := range tests {
+		err := Validate(strings.NewReader(test.input), test.options...)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestValidate(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestValidate(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err == nil:
+			continue
+		}
+
+		var sErr *SyntaxError
+		if !errors.As(err, &sErr) {
+			t.Errorf("TestValidate(%s): got err == %v, want *SyntaxError", test.desc, err)
+			continue
+		}
+		if sErr.Path != test.path {
+			t.Errorf("TestValidate(%s): got path %q, want %q", test.desc, sErr.Path, test.path)
+		}
+	}
+
+	var lErr *LimitError
+	err := Validate(strings.NewReader(strings.Repeat("[", 1000)), WithLimits(Limits{MaxDepth: 10}))
+	if !errors.As(err, &lErr) || lErr.Limit != "MaxDepth" {
+		t.Errorf("TestValidate(MaxDepth): got err == %v, want *LimitError for MaxDepth", err)
+	}
+}
+
+func BenchmarkValidateLarge(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := Validate(strings.NewReader(largeJSON)); err != nil {
+			panic(err)
+		}
+	}
+}
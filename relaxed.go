@@ -0,0 +1,147 @@
+package jsonfs
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"unicode"
+)
+
+// This file holds the decoding of the JSONC and JSON5 extensions allowed by
+// WithRelaxed() and WithNonFinite().
+
+// skipComment skips a // or /* */ comment if one is next in b. It reports if
+// a comment was skipped. A /* comment that is not closed is a *SyntaxError,
+// which is recorded as a read error so that reading the end of the input
+// returns it instead of io.EOF.
+func skipComment(b *decoder) bool {
+	x, err := b.Peek(2)
+	if err != nil || x[0] != '/' {
+		return false
+	}
+
+	switch x[1] {
+	case '/':
+		for {
+			c, err := b.ReadByte()
+			if err != nil || c == '\n' {
+				return true
+			}
+		}
+	case '*':
+		_, line, column := b.pos()
+		b.ReadByte()
+		b.ReadByte()
+		star := false
+		for {
+			c, err := b.ReadByte()
+			if err == io.EOF {
+				b.readErr = b.syntaxError(fmt.Errorf("/* comment at line %d, column %d is not closed", line, column))
+				return true
+			}
+			if err != nil {
+				return true
+			}
+			if star && c == '/' {
+				return true
+			}
+			star = c == '*'
+		}
+	}
+	return false
+}
+
+// isIdentStart reports if r can start an unquoted object key.
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+// isIdentPart reports if r can be part of an unquoted object key.
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r)
+}
+
+// getIdentifier reads an unquoted object key from b.
+func getIdentifier(b *decoder) ([]byte, error) {
+	var s []byte
+	for {
+		r, size, err := b.ReadRune()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if !isIdentPart(r) {
+			b.UnreadRune()
+			break
+		}
+		if size == 1 {
+			s = append(s, byte(r))
+		} else {
+			s = append(s, string(r)...)
+		}
+		if max := b.opts.limits.MaxStringLen; max > 0 && len(s) > max {
+			return nil, b.limitError("MaxStringLen", int64(max))
+		}
+	}
+	if len(s) == 0 {
+		return nil, fmt.Errorf("object key expected")
+	}
+	return s, nil
+}
+
+// isHexByte reports if c is a hex digit letter or the x of 0x. With
+// WithRelaxed(), these are read as part of a number along with the bytes that
+// isNumberByte() allows. e and E are in both, as hex digits and as exponents,
+// so a number is only known to be hex when hexToDecimal() finds the 0x.
+func isHexByte(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F', c == 'x', c == 'X':
+		return true
+	}
+	return false
+}
+
+// hexToDecimal converts a hex number such as 0x1F or -0x1F to decimal. If b is
+// not a hex number, it is returned as is.
+func hexToDecimal(b []byte) ([]byte, error) {
+	digits := b
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+	}
+	if len(digits) < 2 || digits[0] != '0' || (digits[1] != 'x' && digits[1] != 'X') {
+		return b, nil
+	}
+	digits = digits[2:]
+
+	if len(digits) == 0 {
+		return nil, fmt.Errorf("invalid hex number %q", b)
+	}
+	for _, c := range digits {
+		if !isDigit(c) && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return nil, fmt.Errorf("invalid hex number %q", b)
+		}
+	}
+
+	i, _ := new(big.Int).SetString(string(digits), 16)
+	if b[0] == '-' {
+		i.Neg(i)
+	}
+	return i.Append(nil, 10), nil
+}
+
+// nonFinite are the numbers allowed by WithNonFinite().
+var nonFinite = []string{"Infinity", "-Infinity", "NaN"}
+
+// nonFiniteLen returns the length of Infinity, -Infinity or NaN if one is next
+// in b, otherwise 0.
+func nonFiniteLen(b *decoder) int {
+	x, _ := b.Peek(len("-Infinity")) // Returns what it can on an error.
+	for _, nf := range nonFinite {
+		if len(x) >= len(nf) && ByteSlice2String(x[:len(nf)]) == nf {
+			return len(nf)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,352 @@
+package jsonfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+//go:generate stringer -type=TokenKind
+
+// TokenKind is the kind of a Token.
+type TokenKind uint8
+
+const (
+	TokenBeginObject TokenKind = 0
+	TokenEndObject   TokenKind = 1
+	TokenBeginArray  TokenKind = 2
+	TokenEndArray    TokenKind = 3
+	// TokenKey is an object key. The key's value is the next token.
+	TokenKey    TokenKind = 4
+	TokenString TokenKind = 5
+	TokenNumber TokenKind = 6
+	TokenBool   TokenKind = 7
+	TokenNull   TokenKind = 8
+)
+
+// Token is a piece of JSON returned by Scanner.Next().
+type Token struct {
+	// Kind is the kind of token.
+	Kind TokenKind
+	// Type is the FileType a File holding this value would have. It is only set
+	// for TokenString, TokenNumber, TokenBool and TokenNull.
+	Type FileType
+	// Value is the key or value. Keys and strings have their escape sequences
+	// decoded and do not have quotes. Numbers, bools and null are as they were
+	// in the input. It is empty for the other kinds. Value is only valid until
+	// the next call to Scanner.Next().
+	Value []byte
+
+	// Offset is the offset in the input of the first byte of the token and
+	// End is the offset just after the last byte.
+	Offset, End int64
+	// Line and Column are where the token starts, both start at 1.
+	Line, Column int
+}
+
+// scanState is what a Scanner expects to read next.
+type scanState uint8
+
+const (
+	// scanTop is the start of a top level value or the end of the input.
+	scanTop scanState = iota
+	// scanValue is a value after an object key.
+	scanValue
+	// scanAfterValue is the comma or close character after a value.
+	scanAfterValue
+	// scanFirstKey is the first key of an object or its close brace.
+	scanFirstKey
+	// scanFirstElem is the first element of an array or its close bracket.
+	scanFirstElem
+)
+
+// scanFrame is an object or array a Scanner is in.
+type scanFrame struct {
+	array bool
+	// n is the number of keys or elements read so far.
+	n int
+}
+
+// Scanner reads JSON one token at a time without building a Directory. This
+// is useful for tools that only need part of a large input. It uses the same
+// parsing as UnmarshalJSON() and takes the same options, but repeated object
+// keys are not checked. The input may hold many JSON values, such as NDJSON.
+//
+// Memory use does not depend on the size of the input, only on the nesting depth
+// and the size of the largest string or number.
+type Scanner struct {
+	d *decoder
+	// stack holds the objects and arrays we are in, the innermost last.
+	stack []scanFrame
+	state scanState
+	// raw causes strings to be returned without decoding the escape sequences.
+	// They are still checked.
+	raw bool
+	// buff holds the last string and scratch is used to check its escape sequences.
+	buff, scratch []byte
+	// err is returned by all calls to Next() after it is set.
+	err error
+}
+
+// NewScanner creates a Scanner that reads from r. We use a bufio.Reader
+// underneath, so r is not usable after.
+func NewScanner(r io.Reader, options ...DecodeOption) *Scanner {
+	b, ok := r.(*bufio.Reader)
+	if !ok {
+		b = bufio.NewReader(r)
+	}
+	d := &decoder{}
+	d.reset(b)
+	d.opts = newDecodeOptions(options)
+	return newScanner(d)
+}
+
+// newScanner creates a Scanner that reads from d.
+func newScanner(d *decoder) *Scanner {
+	return &Scanner{d: d, stack: make([]scanFrame, 0, 8)}
+}
+
+// Next returns the next token. At the end of the input, io.EOF is returned.
+// If the input is not valid JSON, a *SyntaxError is returned. Errors from the
+// underlying io.Reader and *LimitError are returned as they are. Once an
+// error is returned, all calls to Next() return it.
+func (s *Scanner) Next() (Token, error) {
+	if s.err != nil {
+		return Token{}, s.err
+	}
+
+	var tok Token
+	var err error
+	switch s.state {
+	case scanTop:
+		tok, err = s.top()
+	case scanValue:
+		tok, err = s.value()
+	case scanAfterValue:
+		tok, err = s.afterValue()
+	case scanFirstKey:
+		tok, err = s.first(closeBrace)
+	case scanFirstElem:
+		tok, err = s.first(closeBracket)
+	}
+	if err != nil {
+		if s.err == nil {
+			s.err = s.d.syntaxError(err)
+		}
+		return Token{}, s.err
+	}
+	return tok, nil
+}
+
+// Path returns the path of the last token as a JSON Pointer (RFC 6901), such
+// as "/users/0/name". For a TokenKey this includes the key. For an end token,
+// it is the path of the object or array that ended. Top level values have the
+// path "".
+func (s *Scanner) Path() string {
+	return s.d.pathString()
+}
+
+// Depth returns how many objects and arrays the Scanner is in. This counts
+// the object or array of the last token if it was a begin token, but not if
+// it was an end token.
+func (s *Scanner) Depth() int {
+	return len(s.stack)
+}
+
+// Skip skips the rest of the innermost object or array, including its end
+// token. Called after a begin token, this skips the whole object or array. At
+// the top level, Skip does nothing.
+func (s *Scanner) Skip() error {
+	depth := len(s.stack)
+	for len(s.stack) >= depth && depth > 0 {
+		if _, err := s.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newToken returns a Token of kind starting at the current position.
+func (s *Scanner) newToken(kind TokenKind) Token {
+	offset, line, column := s.d.pos()
+	return Token{Kind: kind, Offset: offset, Line: line, Column: column}
+}
+
+// top reads the start of a top level value.
+func (s *Scanner) top() (Token, error) {
+	s.d.startValue()
+	if _, err := s.d.Peek(1); err != nil {
+		if err == io.EOF {
+			s.err = io.EOF
+		}
+		return Token{}, err
+	}
+	return s.value()
+}
+
+// value reads the next value, which may begin an object or array.
+func (s *Scanner) value() (Token, error) {
+	next, err := valueCheck(s.d)
+	if err != nil {
+		return Token{}, err
+	}
+
+	var tok Token
+	var f File
+	switch next {
+	case msgNext, arrayNext:
+		if err := checkDepth(s.d); err != nil {
+			return Token{}, err
+		}
+		tok = s.newToken(TokenBeginObject)
+		s.state = scanFirstKey
+		if next == arrayNext {
+			tok.Kind = TokenBeginArray
+			s.state = scanFirstElem
+		}
+		s.d.ReadByte() // The open brace or bracket, which valueCheck() found.
+		s.stack = append(s.stack, scanFrame{array: next == arrayNext})
+		tok.End = s.d.offset
+		return tok, nil
+	case stringNext:
+		tok = s.newToken(TokenString)
+		tok.Type = FTString
+		tok.Value, err = s.str()
+		if err != nil {
+			return Token{}, err
+		}
+	case trueNext, falseNext:
+		tok = s.newToken(TokenBool)
+		f, err = decodeBool(s.d, "", next, time.Time{})
+	case numNext:
+		tok = s.newToken(TokenNumber)
+		f, err = decodeNumber(s.d, "", time.Time{})
+	case nullNext:
+		tok = s.newToken(TokenNull)
+		f, err = decodeNull(s.d, "", time.Time{})
+	default:
+		err = fmt.Errorf("unexpected value type, got %v", next)
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	if next != stringNext {
+		tok.Type = f.t
+		tok.Value = f.value
+	}
+	tok.End = s.d.offset
+	s.state = scanAfterValue
+	return tok, nil
+}
+
+// str reads a string.
+func (s *Scanner) str() ([]byte, error) {
+	b, err := appendRawString(s.buff[:0], s.d, true)
+	if err != nil {
+		return nil, err
+	}
+	s.buff = b
+	if !s.raw {
+		return unescape(b, s.d.opts.relaxed)
+	}
+	s.scratch = append(s.scratch[:0], b...)
+	if _, err := unescape(s.scratch, s.d.opts.relaxed); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// afterValue reads the comma or close character after a value.
+func (s *Scanner) afterValue() (Token, error) {
+	if len(s.stack) == 0 {
+		return s.top()
+	}
+	s.d.popPath()
+
+	close := byte(closeBrace)
+	if s.stack[len(s.stack)-1].array {
+		close = closeBracket
+	}
+
+	member, err := nextMember(s.d, close)
+	if err != nil {
+		return Token{}, err
+	}
+	if !member {
+		return s.end(), nil
+	}
+	return s.member()
+}
+
+// first reads the first key or element after an open brace or bracket, or
+// the close character.
+func (s *Scanner) first(close byte) (Token, error) {
+	empty, err := closeNext(s.d, close)
+	if err != nil {
+		return Token{}, err
+	}
+	if empty {
+		return s.end(), nil
+	}
+	return s.member()
+}
+
+// member reads the next key of an object or element of an array.
+func (s *Scanner) member() (Token, error) {
+	frame := &s.stack[len(s.stack)-1]
+	if !frame.array {
+		return s.key(frame)
+	}
+
+	s.d.pushPath(strconv.Itoa(frame.n))
+	if max := s.d.opts.limits.MaxArrayLen; max > 0 && frame.n >= max {
+		return Token{}, s.d.limitError("MaxArrayLen", int64(max))
+	}
+	frame.n++
+	return s.value()
+}
+
+// key reads an object key and the colon after it.
+func (s *Scanner) key(frame *scanFrame) (Token, error) {
+	ident, err := keyStart(s.d)
+	if err != nil {
+		return Token{}, err
+	}
+
+	tok := s.newToken(TokenKey)
+	if ident {
+		tok.Value, err = getIdentifier(s.d)
+	} else {
+		tok.Value, err = s.str()
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	tok.End = s.d.offset
+	s.d.pushPath(string(tok.Value))
+	if max := s.d.opts.limits.MaxKeys; max > 0 && frame.n >= max {
+		return Token{}, s.d.limitError("MaxKeys", int64(max))
+	}
+	frame.n++
+
+	if err := keyEnd(s.d); err != nil {
+		return Token{}, err
+	}
+	s.state = scanValue
+	return tok, nil
+}
+
+// end reads the close character of the object or array we are in.
+func (s *Scanner) end() Token {
+	tok := s.newToken(TokenEndObject)
+	if s.stack[len(s.stack)-1].array {
+		tok.Kind = TokenEndArray
+	}
+	s.d.ReadByte()
+	tok.End = s.d.offset
+	s.stack = s.stack[:len(s.stack)-1]
+	s.state = scanAfterValue
+	return tok
+}
@@ -0,0 +1,254 @@
+package jsonfs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// scanAll returns each token from s as "Kind Value Path", with the Type for values.
+func scanAll(s *Scanner) ([]string, error) {
+	var got []string
+	for {
+		tok, err := s.Next()
+		if err == io.EOF {
+			return got, nil
+		}
+		if err != nil {
+			return got, err
+		}
+		switch tok.Kind {
+		case TokenString, TokenNumber, TokenBool, TokenNull:
+			got = append(got, fmt.Sprintf("%v(%v) %s %s", tok.Kind, tok.Type, tok.Value, s.Path()))
+		default:
+			got = append(got, fmt.Sprintf("%v %s %s", tok.Kind, tok.Value, s.Path()))
+		}
+	}
+}
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		options []DecodeOption
+		want    []string
+		err     bool
+	}{
+		{
+			desc:  "object",
+			input: `{"a": {"b": [1, 2.5, "x\ny"], "c": {}}, "d": [], "e": null, "f": true}`,
+			want: []string{
+				"TokenBeginObject  ",
+				"TokenKey a /a",
+				"TokenBeginObject  /a",
+				"TokenKey b /a/b",
+				"TokenBeginArray  /a/b",
+				"TokenNumber(FTInt) 1 /a/b/0",
+				"TokenNumber(FTFloat) 2.5 /a/b/1",
+				"TokenString(FTString) x\ny /a/b/2",
+				"TokenEndArray  /a/b",
+				"TokenKey c /a/c",
+				"TokenBeginObject  /a/c",
+				"TokenEndObject  /a/c",
+				"TokenEndObject  /a",
+				"TokenKey d /d",
+				"TokenBeginArray  /d",
+				"TokenEndArray  /d",
+				"TokenKey e /e",
+				"TokenNull(FTNull) null /e",
+				"TokenKey f /f",
+				"TokenBool(FTBool) true /f",
+				"TokenEndObject  ",
+			},
+		},
+		{
+			desc:  "many values",
+			input: "{\"a\": 1}\n[\"b\"]\n3 \"s\"\n",
+			want: []string{
+				"TokenBeginObject  ",
+				"TokenKey a /a",
+				"TokenNumber(FTInt) 1 /a",
+				"TokenEndObject  ",
+				"TokenBeginArray  ",
+				"TokenString(FTString) b /0",
+				"TokenEndArray  ",
+				"TokenNumber(FTInt) 3 ",
+				"TokenString(FTString) s ",
+			},
+		},
+		{
+			desc:  "empty input",
+			input: " \n ",
+		},
+		{
+			desc:    "relaxed",
+			input:   "{a: 'b', /* c */ c: [0x10,],}",
+			options: []DecodeOption{WithRelaxed()},
+			want: []string{
+				"TokenBeginObject  ",
+				"TokenKey a /a",
+				"TokenString(FTString) b /a",
+				"TokenKey c /c",
+				"TokenBeginArray  /c",
+				"TokenNumber(FTInt) 16 /c/0",
+				"TokenEndArray  /c",
+				"TokenEndObject  ",
+			},
+		},
+		{
+			desc:  "duplicate keys are returned",
+			input: `{"a": 1, "a": 2}`,
+			want: []string{
+				"TokenBeginObject  ",
+				"TokenKey a /a",
+				"TokenNumber(FTInt) 1 /a",
+				"TokenKey a /a",
+				"TokenNumber(FTInt) 2 /a",
+				"TokenEndObject  ",
+			},
+		},
+		{
+			desc:  "error after some tokens",
+			input: `{"a": [1 2]}`,
+			want: []string{
+				"TokenBeginObject  ",
+				"TokenKey a /a",
+				"TokenBeginArray  /a",
+				"TokenNumber(FTInt) 1 /a/0",
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := scanAll(NewScanner(strings.NewReader(test.input), test.options...))
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestScanner(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestScanner(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestScanner(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestScannerOffsets(t *testing.T) {
+	input := "{\"a\": [true,\n  \"b\"]}"
+	want := []Token{
+		{Kind: TokenBeginObject, Offset: 0, End: 1, Line: 1, Column: 1},
+		{Kind: TokenKey, Offset: 1, End: 4, Line: 1, Column: 2},
+		{Kind: TokenBeginArray, Offset: 6, End: 7, Line: 1, Column: 7},
+		{Kind: TokenBool, Offset: 7, End: 11, Line: 1, Column: 8},
+		{Kind: TokenString, Offset: 15, End: 18, Line: 2, Column: 3},
+		{Kind: TokenEndArray, Offset: 18, End: 19, Line: 2, Column: 6},
+		{Kind: TokenEndObject, Offset: 19, End: 20, Line: 2, Column: 7},
+	}
+
+	s := NewScanner(strings.NewReader(input))
+	for i, w := range want {
+		tok, err := s.Next()
+		if err != nil {
+			t.Fatalf("TestScannerOffsets: token %d: got err == %s, want err == nil", i, err)
+		}
+		if tok.Kind != w.Kind || tok.Offset != w.Offset || tok.End != w.End || tok.Line != w.Line || tok.Column != w.Column {
+			t.Errorf("TestScannerOffsets: token %d: got %v at %d-%d (%d:%d), want %v at %d-%d (%d:%d)",
+				i, tok.Kind, tok.Offset, tok.End, tok.Line, tok.Column, w.Kind, w.Offset, w.End, w.Line, w.Column)
+		}
+	}
+	if _, err := s.Next(); err != io.EOF {
+		t.Errorf("TestScannerOffsets: got err == %v, want io.EOF", err)
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	s := NewScanner(strings.NewReader(`{"a": [1, 2, 01]}`))
+	_, err := scanAll(s)
+	var sErr *SyntaxError
+	if !errors.As(err, &sErr) {
+		t.Fatalf("TestScannerErrors: got err == %v, want *SyntaxError", err)
+	}
+	if sErr.Path != "/a/2" {
+		t.Errorf("TestScannerErrors: got path %q, want %q", sErr.Path, "/a/2")
+	}
+	if _, again := s.Next(); again != err {
+		t.Errorf("TestScannerErrors: got err == %v after an error, want the same error", again)
+	}
+
+	var lErr *LimitError
+	_, err = scanAll(NewScanner(strings.NewReader(`{"a": [1, 2, 3]}`), WithLimits(Limits{MaxArrayLen: 2})))
+	if !errors.As(err, &lErr) || lErr.Limit != "MaxArrayLen" || lErr.Path != "/a/2" {
+		t.Errorf("TestScannerErrors: got err == %v, want *LimitError for MaxArrayLen at /a/2", err)
+	}
+}
+
+// TestSameErrors checks that UnmarshalJSON(), Scanner and skipValue() find the
+// same error at the same place.
+func TestSameErrors(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		options []DecodeOption
+	}{
+		{desc: "missing comma", input: `{"a": [1 2]}`},
+		{desc: "missing comma in object", input: `{"a": 1 "b": 2}`},
+		{desc: "mismatched close", input: `{"a": [1}`},
+		{desc: "truncated", input: `{"a": [1,`},
+		{desc: "bad key", input: `{"a": 1, 2: 3}`},
+		{desc: "non-ASCII key", input: `{é: 1}`},
+		{desc: "missing colon", input: `{"a" 1}`},
+		{desc: "bad literal", input: `[true, nul]`},
+		{desc: "bad bool", input: `[fals]`},
+		{desc: "bad value", input: `{"a": x}`},
+		{desc: "bad escape", input: `["\x"]`},
+		{desc: "bad number", input: `[1, 01]`},
+		{desc: "relaxed bad key", input: `{1a: 1}`, options: []DecodeOption{WithRelaxed()}},
+		{desc: "relaxed double comma", input: `[1,,]`, options: []DecodeOption{WithRelaxed()}},
+	}
+
+	for _, test := range tests {
+		opts := newDecodeOptions(test.options)
+		_, want := UnmarshalJSON(strings.NewReader(test.input), test.options...)
+		_, scanErr := scanAll(NewScanner(strings.NewReader(test.input), test.options...))
+
+		d := newDecoder(bufio.NewReader(strings.NewReader(test.input)), opts)
+		skipErr := d.syntaxError(skipValue(d))
+		d.close()
+
+		var wErr *SyntaxError
+		if !errors.As(want, &wErr) {
+			t.Errorf("TestSameErrors(%s): UnmarshalJSON: got err == %v, want *SyntaxError", test.desc, want)
+			continue
+		}
+		for name, err := range map[string]error{"Scanner": scanErr, "skipValue": skipErr} {
+			var sErr *SyntaxError
+			if !errors.As(err, &sErr) || sErr.Msg != wErr.Msg || sErr.Offset != wErr.Offset {
+				t.Errorf("TestSameErrors(%s): %s: got err == %v, want %v", test.desc, name, err, want)
+			}
+		}
+	}
+}
+
+func BenchmarkScannerLarge(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := NewScanner(strings.NewReader(largeJSON))
+		for {
+			_, err := s.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
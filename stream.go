@@ -0,0 +1,335 @@
+package jsonfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Stream is a stream object from UnmarshalStream().
+type Stream struct {
+	// Value is the JSON value that was decoded. This is a Directory for a
+	// JSON object or array and a File for any other JSON value.
+	Value FileOrDir
+	// Dir is the JSON object or array as a Directory. This is only set if
+	// Value is a Directory.
+	Dir Directory
+	// Index is the position of the value in the stream, or of the element in
+	// the array, starting at 0.
+	Index int
+	// Start and End are the offsets in the input of the first byte of the
+	// value and of the byte after it. End can be saved as a checkpoint to
+	// resume decoding from with UnmarshalStreamFrom(). For a *RecordError,
+	// they are the input that was skipped, including the newline at the end.
+	// They are not set for other errors.
+	Start, End int64
+	// Err indicates that there was an error in the stream.
+	Err error
+}
+
+// WithSkipErrors causes UnmarshalStream() and UnmarshalStreamParallel() to
+// skip a value that has an error and go on with the next one, instead of
+// stopping. This is for streams that may have some bad values in them, like
+// NDJSON logs that had writes cut short. The skipped value is sent as a Stream
+// whose Err is a *RecordError, which has where the value was and the input that
+// was skipped. Errors from the io.Reader, a Limits.MaxBytes *LimitError and a
+// *CanceledError still stop the stream.
+//
+// UnmarshalStream() skips from the start of the value to the end of the line it
+// starts on, so the value after it should start on a new line, as it does in
+// NDJSON. UnmarshalStreamParallel() does the same when the end of the value is
+// not found, but otherwise only skips the value.
+//
+// If summary is not nil, it is set to how many values were decoded and skipped
+// before the channel is closed.
+func WithSkipErrors(summary *StreamSummary) DecodeOption {
+	return func(o *decodeOptions) {
+		o.skipErrors = true
+		o.summary = summary
+	}
+}
+
+// StreamSummary counts the values in a stream, see WithSkipErrors().
+type StreamSummary struct {
+	// Decoded is how many values were decoded and sent.
+	Decoded int
+	// Skipped is how many values were skipped because they had an error.
+	Skipped int
+}
+
+// save copies s to dst if it is not nil.
+func (s *StreamSummary) save(dst *StreamSummary) {
+	if dst != nil {
+		*dst = *s
+	}
+}
+
+// UnmarshalStream unmarshals a stream of JSON values from a reader. This
+// handles newline delimited JSON (NDJSON) as well as values that are simply
+// concatenated, with or without whitespace between them. Values can be objects,
+// arrays or basic values such as strings or numbers. The channel is closed
+// when the reader returns io.EOF after the last value. If ctx is canceled,
+// the decoding in progress stops and a Stream with a *CanceledError is sent if
+// the receiver is still reading.
+func UnmarshalStream(ctx context.Context, r io.Reader, options ...DecodeOption) chan Stream {
+	return unmarshalStream(ctx, r, 0, newDecodeOptions(options))
+}
+
+// UnmarshalStreamFrom is like UnmarshalStream(), but starts decoding r at
+// offset, which should be the Stream.End of a value from decoding the same
+// input before. This lets a long running job save Stream.End as a checkpoint
+// and resume from it after a restart instead of starting over. Offsets in the
+// Streams and errors count from the start of r, but line numbers count from
+// offset and Index starts at 0.
+func UnmarshalStreamFrom(ctx context.Context, r io.ReadSeeker, offset int64, options ...DecodeOption) chan Stream {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return errStream(fmt.Errorf("could not seek to offset %d: %w", offset, err))
+	}
+	return unmarshalStream(ctx, r, offset, newDecodeOptions(options))
+}
+
+// unmarshalStream implements UnmarshalStream() for r, which starts at offset in
+// the input.
+func unmarshalStream(ctx context.Context, r io.Reader, offset int64, opts decodeOptions) chan Stream {
+	ch := make(chan Stream, 1)
+
+	go func() {
+		defer close(ch)
+
+		d, done := newStreamDecoder(r, opts)
+		defer done()
+		d.seek(offset, 1, offset, nil)
+
+		var sum StreamSummary
+		defer sum.save(opts.summary)
+
+		for i := 0; ; i++ {
+			if err := checkCtx(ctx); err != nil {
+				sendStream(ctx, ch, Stream{Index: i, Err: err})
+				return
+			}
+
+			d.startValue()
+			start, line := d.offset, d.line
+			if opts.skipErrors {
+				d.capturing, d.capture = true, d.capture[:0]
+			}
+			v, err := decodeValue(ctx, d, "")
+			d.capturing = false
+			if err != nil {
+				if err == io.EOF {
+					return
+				}
+				if d.skippable(err) {
+					err = d.skipRecord(start, line, d.capture, err)
+				}
+				s := Stream{Index: i, Err: err}
+				_, skipped := err.(*RecordError)
+				if skipped {
+					s.Start, s.End = start, d.offset
+				}
+				if !sendStream(ctx, ch, s) || !skipped {
+					return
+				}
+				sum.Skipped++
+				continue
+			}
+			if !sendStream(ctx, ch, newStream(v, i, start, d.offset)) {
+				return
+			}
+			sum.Decoded++
+		}
+	}()
+	return ch
+}
+
+// UnmarshalArrayStream unmarshals each element of a JSON array that is the
+// top level value in a reader, sending each one on the channel as soon as it
+// is decoded. This allows decoding arrays that are too large to hold in memory.
+// Each element is named with its index in the array. The channel is closed after
+// the closing bracket of the array is read. Cancellation works the same as
+// UnmarshalStream().
+func UnmarshalArrayStream(ctx context.Context, r io.Reader, options ...DecodeOption) chan Stream {
+	ch := make(chan Stream, 1)
+	opts := newDecodeOptions(options)
+
+	go func() {
+		defer close(ch)
+
+		b := bufioReader(r)
+		defer putReader(b, r)
+		d := newDecoder(b, opts)
+		defer d.close()
+
+		n, err := eachElement(ctx, d, func(i int, name string) (bool, error) {
+			start := d.offset
+			v, err := decodeValue(ctx, d, name)
+			if err != nil {
+				return false, d.syntaxError(err)
+			}
+			return sendStream(ctx, ch, newStream(v, i, start, d.offset)), nil
+		})
+		if err != nil {
+			sendStream(ctx, ch, Stream{Index: n, Err: err})
+		}
+	}()
+	return ch
+}
+
+// eachElement reads the array that is the top level value in d. For each
+// element, it calls elem with the element's index and name when the element
+// is next in d. The name is on d's path while elem is called. elem must read
+// the element and reports if we should go on. It returns how many elements
+// elem read and the first error, which is for the element at that index.
+func eachElement(ctx context.Context, d *decoder, elem func(i int, name string) (bool, error)) (int, error) {
+	skipSpace(d)
+	c, err := d.ReadByte()
+	switch {
+	case err != nil:
+		return 0, d.syntaxError(err)
+	case c != openBracket:
+		d.UnreadByte()
+		return 0, d.syntaxError(fmt.Errorf("expected array open bracket, found %q", d.peekRune()))
+	}
+
+	empty, err := closeNext(d, closeBracket)
+	switch {
+	case err != nil:
+		return 0, d.syntaxError(err)
+	case empty:
+		d.ReadByte()
+		return 0, nil
+	}
+
+	for i := 0; ; i++ {
+		if err := checkCtx(ctx); err != nil {
+			return i, err
+		}
+
+		name := strconv.Itoa(i)
+		d.pushPath(name)
+		if max := d.opts.limits.MaxArrayLen; max > 0 && i >= max {
+			return i, d.limitError("MaxArrayLen", int64(max))
+		}
+		d.startValue()
+		ok, err := elem(i, name)
+		if err != nil || !ok {
+			return i, err
+		}
+		d.popPath()
+
+		member, err := nextMember(d, closeBracket)
+		if err != nil {
+			return i + 1, d.syntaxError(err)
+		}
+		if !member {
+			d.ReadByte()
+			return i + 1, nil
+		}
+	}
+}
+
+// newStream returns a Stream holding v, which is at index in the stream and
+// was read from the input between start and end.
+func newStream(v FileOrDir, index int, start, end int64) Stream {
+	s := Stream{Value: v, Index: index, Start: start, End: end}
+	if dir, ok := v.(Directory); ok {
+		s.Dir = dir
+	}
+	return s
+}
+
+// newStreamDecoder returns a decoder for a stream of values from r. done must
+// be called when decoding is done.
+func newStreamDecoder(r io.Reader, opts decodeOptions) (*decoder, func()) {
+	var replay *replayReader
+	if opts.skipErrors {
+		replay = &replayReader{r: r}
+		r = replay
+	}
+	b := bufioReader(r)
+	d := newDecoder(b, opts)
+	d.replay = replay
+	return d, func() {
+		d.close()
+		putReader(b, r)
+	}
+}
+
+// replayReader reads pending before reading from r. It lets skipRecord() put
+// back input that was read past the end of a line.
+type replayReader struct {
+	pending []byte
+	r       io.Reader
+}
+
+// Read implements io.Reader.Read().
+func (r *replayReader) Read(p []byte) (int, error) {
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	return r.r.Read(p)
+}
+
+// skippable reports if err, which a value had, can be skipped because of
+// WithSkipErrors().
+func (d *decoder) skippable(err error) bool {
+	var cErr *CanceledError
+	return d.opts.skipErrors && d.readErr == nil && !errors.As(err, &cErr)
+}
+
+// skipRecord skips a value that had err, which started at offset on line.
+// read is what was read of the value. The rest of the line the value starts on
+// is skipped and anything read after that line is read again. It returns a
+// *RecordError for the value, or the error that keeps it from being skipped.
+func (d *decoder) skipRecord(offset int64, line int, read []byte, err error) error {
+	rec := &RecordError{Offset: offset, Line: line, Err: err}
+
+	i := bytes.IndexByte(read, '\n')
+	if i < 0 {
+		read, err := d.readBytes(read, 0, '\n', "", 0)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		rec.Raw = append([]byte(nil), bytes.TrimSuffix(read, []byte{'\n'})...)
+		return rec
+	}
+	rec.Raw = append([]byte(nil), read[:i]...)
+
+	// Put what was read after the line back in front of what is buffered.
+	buffered, _ := d.b.Peek(d.b.Buffered())
+	pending := make([]byte, 0, len(read)-i-1+len(buffered)+len(d.replay.pending))
+	pending = append(pending, read[i+1:]...)
+	pending = append(pending, buffered...)
+	d.replay.pending = append(pending, d.replay.pending...)
+	d.b.Reset(d.replay)
+
+	next := offset + int64(i) + 1
+	d.seek(next, line+1, next, read[:i+1])
+	d.lastSize = -1
+	d.path = d.path[:0]
+	return rec
+}
+
+// errStream returns a closed channel that holds a Stream with err.
+func errStream(err error) chan Stream {
+	ch := make(chan Stream, 1)
+	ch <- Stream{Err: err}
+	close(ch)
+	return ch
+}
+
+// sendStream sends s on ch unless ctx is done. It reports if s was sent.
+func sendStream(ctx context.Context, ch chan Stream, s Stream) bool {
+	select {
+	case ch <- s:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
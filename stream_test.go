@@ -0,0 +1,316 @@
+package jsonfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// streamOutput marshals every value in the stream and returns them, stopping at the first error.
+func streamOutput(ch chan Stream) ([]string, error) {
+	var got []string
+	for s := range ch {
+		if s.Err != nil {
+			return got, s.Err
+		}
+		buff := &bytes.Buffer{}
+		if err := MarshalJSON(buff, s.Value); err != nil {
+			return got, err
+		}
+		got = append(got, buff.String())
+	}
+	return got, nil
+}
+
+func TestUnmarshalStream(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+		err   bool
+	}{
+		{
+			desc:  "ndjson with an empty object",
+			input: "{\"a\": 1}\n{}\n{\"b\": [2]}\n",
+			want:  []string{`{"a":1}`, `{}`, `{"b":[2]}`},
+		},
+		{
+			desc:  "concatenated values of any type",
+			input: `{"a":1}[1,2]"str" 3 true null{}`,
+			want:  []string{`{"a":1}`, `[1,2]`, `"str"`, `3`, `true`, `null`, `{}`},
+		},
+		{
+			desc:  "empty input",
+			input: " \n ",
+		},
+		{
+			desc:  "error after a good record",
+			input: "{\"a\": 1}\n{\"a\": }",
+			want:  []string{`{"a":1}`},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := streamOutput(UnmarshalStream(context.Background(), strings.NewReader(test.input)))
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestUnmarshalStream(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.err:
+			t.Errorf("TestUnmarshalStream(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("TestUnmarshalStream(%s): got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalArrayStream(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+		err   bool
+	}{
+		{
+			desc:  "mixed elements",
+			input: ` [ {"a": 1}, [], "s", 2.5, {} ] `,
+			want:  []string{`{"a":1}`, `[]`, `"s"`, `2.5`, `{}`},
+		},
+		{
+			desc:  "empty array",
+			input: `[]`,
+		},
+		{
+			desc:  "not an array",
+			input: `{"a": 1}`,
+			err:   true,
+		},
+		{
+			desc:  "truncated",
+			input: `[{"a": 1}, {"a": 2}`,
+			want:  []string{`{"a":1}`, `{"a":2}`},
+			err:   true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := streamOutput(UnmarshalArrayStream(context.Background(), strings.NewReader(test.input)))
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestUnmarshalArrayStream(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.err:
+			t.Errorf("TestUnmarshalArrayStream(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("TestUnmarshalArrayStream(%s): got %v, want %v", test.desc, got, test.want)
+		}
+	}
+
+	// Errors should have the path of the array element.
+	var sErr *SyntaxError
+	_, err := streamOutput(UnmarshalArrayStream(context.Background(), strings.NewReader(`[{}, {"a": [tru]}]`)))
+	if !errors.As(err, &sErr) {
+		t.Fatalf("TestUnmarshalArrayStream(bad element): got err == %v, want *SyntaxError", err)
+	}
+	if sErr.Path != "/1/a/0" {
+		t.Errorf("TestUnmarshalArrayStream(bad element): got path %q, want /1/a/0", sErr.Path)
+	}
+}
+
+func TestSkipErrors(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  []string
+		sum   StreamSummary
+	}{
+		{
+			desc:  "bad line",
+			input: "{\"a\": 1}\n{\"a\": }\n{\"b\": 2}\n",
+			want:  []string{`{"a":1}`, `skipped line 2 offset 9: {"a": }`, `{"b":2}`},
+			sum:   StreamSummary{Decoded: 2, Skipped: 1},
+		},
+		{
+			desc:  "line cut short",
+			input: "{\"a\": 1, \"b\"\n{\"c\": 2}\n",
+			want:  []string{`skipped line 1 offset 0: {"a": 1, "b"`, `{"c":2}`},
+			sum:   StreamSummary{Decoded: 1, Skipped: 1},
+		},
+		{
+			desc:  "value read past many lines",
+			input: "{\"a\": [1,\n2,\n{\"b\":1}\n",
+			want:  []string{`skipped line 1 offset 0: {"a": [1,`, `2`, `skipped line 2 offset 11: ,`, `{"b":1}`},
+			sum:   StreamSummary{Decoded: 2, Skipped: 2},
+		},
+		{
+			desc:  "not json",
+			input: "not json\r\n{\"a\": 1}",
+			want:  []string{"skipped line 1 offset 0: not json\r", `{"a":1}`},
+			sum:   StreamSummary{Decoded: 1, Skipped: 1},
+		},
+		{
+			desc:  "second value on a line",
+			input: "1 {x} 2\n3",
+			want:  []string{`1`, `skipped line 1 offset 2: {x} 2`, `3`},
+			sum:   StreamSummary{Decoded: 2, Skipped: 1},
+		},
+		{
+			desc:  "repeated key",
+			input: "{\"a\": 1, \"a\": 2}\n[]",
+			want:  []string{`skipped line 1 offset 0: {"a": 1, "a": 2}`, `[]`},
+			sum:   StreamSummary{Decoded: 1, Skipped: 1},
+		},
+		{
+			desc:  "last line cut short",
+			input: "{\"a\": 1}\n{\"a\"",
+			want:  []string{`{"a":1}`, `skipped line 2 offset 9: {"a"`},
+			sum:   StreamSummary{Decoded: 1, Skipped: 1},
+		},
+	}
+
+	for _, test := range tests {
+		streams := map[string]func(context.Context, io.Reader, ...DecodeOption) chan Stream{
+			"UnmarshalStream":         UnmarshalStream,
+			"UnmarshalStreamParallel": UnmarshalStreamParallel,
+		}
+		for name, stream := range streams {
+			var sum StreamSummary
+			var got []string
+			for s := range stream(context.Background(), strings.NewReader(test.input), WithSkipErrors(&sum)) {
+				var rErr *RecordError
+				switch {
+				case errors.As(s.Err, &rErr):
+					got = append(got, fmt.Sprintf("skipped line %d offset %d: %s", rErr.Line, rErr.Offset, rErr.Raw))
+				case s.Err != nil:
+					got = append(got, "error: "+s.Err.Error())
+				default:
+					buff := &bytes.Buffer{}
+					MarshalJSON(buff, s.Value)
+					got = append(got, buff.String())
+				}
+			}
+			if diff := pretty.Compare(test.want, got); diff != "" {
+				t.Errorf("TestSkipErrors(%s, %s): -want/+got:\n%s", test.desc, name, diff)
+			}
+			if sum != test.sum {
+				t.Errorf("TestSkipErrors(%s, %s): got summary %+v, want %+v", test.desc, name, sum, test.sum)
+			}
+		}
+	}
+
+	// Some errors still stop the stream.
+	input := "{\"a\": \"too long\"}\n{\"a\": 1}\n"
+	var got []Stream
+	for s := range UnmarshalStream(context.Background(), strings.NewReader(input), WithSkipErrors(nil), WithLimits(Limits{MaxBytes: 12})) {
+		got = append(got, s)
+	}
+	var lErr *LimitError
+	if len(got) != 1 || !errors.As(got[0].Err, &lErr) {
+		t.Errorf("TestSkipErrors(MaxBytes): got %d Streams, want 1 with a *LimitError", len(got))
+	}
+}
+
+func TestStreamOffsets(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		array   bool
+		options []DecodeOption
+		want    []string
+	}{
+		{
+			desc:  "values",
+			input: "{\"a\": 1}\n  [2, 3]\n\"x\" 4",
+			want:  []string{`{"a": 1}`, `[2, 3]`, `"x"`, `4`},
+		},
+		{
+			desc:    "skipped value",
+			input:   "1\n{\"a\": }\n2",
+			options: []DecodeOption{WithSkipErrors(nil)},
+			want:    []string{`1`, "{\"a\": }\n", `2`},
+		},
+		{
+			desc:  "array elements",
+			input: `[ {"a": 1}, "x" ,3]`,
+			array: true,
+			want:  []string{`{"a": 1}`, `"x"`, `3`},
+		},
+	}
+
+	for _, test := range tests {
+		streams := map[string]func(context.Context, io.Reader, ...DecodeOption) chan Stream{
+			"UnmarshalStream":         UnmarshalStream,
+			"UnmarshalStreamParallel": UnmarshalStreamParallel,
+		}
+		if test.array {
+			streams = map[string]func(context.Context, io.Reader, ...DecodeOption) chan Stream{
+				"UnmarshalArrayStream":         UnmarshalArrayStream,
+				"UnmarshalArrayStreamParallel": UnmarshalArrayStreamParallel,
+			}
+		}
+		for name, stream := range streams {
+			var got []string
+			for s := range stream(context.Background(), strings.NewReader(test.input), test.options...) {
+				got = append(got, test.input[s.Start:s.End])
+			}
+			if diff := pretty.Compare(test.want, got); diff != "" {
+				t.Errorf("TestStreamOffsets(%s, %s): -want/+got:\n%s", test.desc, name, diff)
+			}
+		}
+	}
+}
+
+func TestUnmarshalStreamFrom(t *testing.T) {
+	const input = "{\"a\": 1}\n{\"b\": 2}\n\n3\n[4]\n"
+
+	all, err := streamOutput(UnmarshalStream(context.Background(), strings.NewReader(input)))
+	if err != nil {
+		t.Fatalf("TestUnmarshalStreamFrom: UnmarshalStream had error: %s", err)
+	}
+
+	// Resuming from the End of each value gives the values after it.
+	i := 0
+	for s := range UnmarshalStream(context.Background(), strings.NewReader(input)) {
+		i++
+		got, err := streamOutput(UnmarshalStreamFrom(context.Background(), strings.NewReader(input), s.End))
+		if err != nil {
+			t.Errorf("TestUnmarshalStreamFrom(offset %d): got err == %s, want err == nil", s.End, err)
+			continue
+		}
+		if strings.Join(got, " ") != strings.Join(all[i:], " ") {
+			t.Errorf("TestUnmarshalStreamFrom(offset %d): got %v, want %v", s.End, got, all[i:])
+		}
+	}
+
+	// Offsets count from the start of the input.
+	const bad = "{\"a\": 1}\n{\"b\": 2}\n{\"c\": }\n"
+	var starts []int64
+	var sErr *SyntaxError
+	for s := range UnmarshalStreamFrom(context.Background(), strings.NewReader(bad), 9) {
+		starts = append(starts, s.Start)
+		if s.Err != nil && !errors.As(s.Err, &sErr) {
+			t.Fatalf("TestUnmarshalStreamFrom(error): got err == %v, want *SyntaxError", s.Err)
+		}
+	}
+	if diff := pretty.Compare([]int64{9, 0}, starts); diff != "" {
+		t.Errorf("TestUnmarshalStreamFrom(error): Start -want/+got:\n%s", diff)
+	}
+	if sErr == nil || sErr.Offset != 24 || sErr.Line != 2 {
+		t.Errorf("TestUnmarshalStreamFrom(error): got %v, want a *SyntaxError at offset 24 on line 2", sErr)
+	}
+	// Nothing before the offset was read, so it cannot be in the excerpt.
+	if sErr != nil && !strings.HasPrefix(sErr.Excerpt, `{"b"`) {
+		t.Errorf("TestUnmarshalStreamFrom(error): got excerpt %q, want it to start at offset 9", sErr.Excerpt)
+	}
+
+	if _, err := streamOutput(UnmarshalStreamFrom(context.Background(), strings.NewReader(input), -1)); err == nil {
+		t.Errorf("TestUnmarshalStreamFrom(bad offset): got err == nil, want err != nil")
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"strconv"
 	"sync"
 	"time"
-	"unicode"
 	"unsafe"
 
 	"github.com/johnsiilver/pools/memory/ptrpool"
@@ -23,33 +22,33 @@ var readerPool = sync.Pool{
 	},
 }
 
-var dictPool *ptrpool.Pool[dictSM]
+// bufioReader returns r as a *bufio.Reader. If r is not already a
+// *bufio.Reader, one is taken from the readerPool. putReader(b, r) must be
+// called when the reader is no longer needed.
+func bufioReader(r io.Reader) *bufio.Reader {
+	if b, ok := r.(*bufio.Reader); ok {
+		return b
+	}
+	b := readerPool.Get().(*bufio.Reader)
+	b.Reset(r)
+	return b
+}
 
-func init() {
-	var err error
-	dictPool, err = ptrpool.New(
-		ptrpool.FreeList{
-			Base: 10,
-			Grow: ptrpool.Grow{
-				Maximum:         1000,
-				MeasurementSpan: 1 * time.Second,
-				Grower:          (&ptrpool.BasicGrower{}).Grower,
-			},
-		},
-		func() *dictSM {
-			return newDictSM(nil, "")
-		},
-	)
-	if err != nil {
-		panic(err)
+// putReader returns b, which bufioReader(r) returned, to the readerPool if it
+// was taken from there.
+func putReader(b *bufio.Reader, r io.Reader) {
+	if b == r {
+		return
 	}
+	b.Reset(nil)
+	readerPool.Put(b)
 }
 
-var arrayPool *ptrpool.Pool[arraySM]
+var parserPool *ptrpool.Pool[parser]
 
 func init() {
 	var err error
-	arrayPool, err = ptrpool.New(
+	parserPool, err = ptrpool.New(
 		ptrpool.FreeList{
 			Base: 10,
 			Grow: ptrpool.Grow{
@@ -58,8 +57,8 @@ func init() {
 				Grower:          (&ptrpool.BasicGrower{}).Grower,
 			},
 		},
-		func() *arraySM {
-			return newArray(nil, "", time.Time{})
+		func() *parser {
+			return &parser{stack: make([]frame, 0, 8)}
 		},
 	)
 	if err != nil {
@@ -84,7 +83,7 @@ func ValueCheck(b *bufio.Reader) (next, error) {
 		return arrayNext, nil
 	case r == doubleQuote:
 		return stringNext, nil
-	case unicode.IsNumber(r):
+	case r == '-' || isDigit(byte(r)):
 		return numNext, nil
 	// bool case
 	case r == 't':
@@ -129,47 +128,32 @@ func DataType(data []byte) (FileType, error) {
 		}
 	}
 
-	if unicode.IsNumber(r) {
-		seenDot := false
-		for {
-			r, _, err := b.ReadRune()
-			if err != nil {
-				if err == io.EOF {
-					t := FTInt
-					if seenDot {
-						t = FTFloat
-					}
-					return t, nil
-				}
-				return 0, fmt.Errorf("could not read rune in WriteFile data: %s", err)
-			}
-			switch {
-			case unicode.IsNumber(r):
-			case r == '.':
-				if !seenDot {
-					seenDot = true
-					continue
-				}
-			}
-			break
+	if r == '-' || isDigit(byte(r)) {
+		if t, err := numberType(data); err == nil {
+			return t, nil
 		}
 	}
 	return FTString, nil
 }
 
-// SskipSpace skips all spaces in the reader.
+// SkipSpace skips the JSON whitespace in the reader, which is space, tab,
+// newline and carriage return.
 func SkipSpace(b *bufio.Reader) {
 	for {
-		r, _, err := b.ReadRune()
-		if err != nil {
-			b.UnreadRune()
-			return
+		if b.Buffered() == 0 {
+			if _, err := b.Peek(1); err != nil {
+				return
+			}
 		}
-		if unicode.IsSpace(r) {
-			continue
+		window, _ := b.Peek(b.Buffered())
+		i := 0
+		for i < len(window) && jsonSpace[window[i]] {
+			i++
+		}
+		b.Discard(i)
+		if i < len(window) {
+			return
 		}
-		b.UnreadRune()
-		return
 	}
 }
 
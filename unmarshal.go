@@ -1,14 +1,17 @@
 package jsonfs
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 	"unicode"
+	"unicode/utf8"
 	"unsafe"
 )
 
@@ -23,536 +26,867 @@ const (
 	comma        = ','
 )
 
-// stateFn is a state function.
-type stateFn func(ctx context.Context) stateFn
-
-// UnmarshalJSON unmarshals a single JSON object from an io.Reader. This object
-// must be an object inside {}. This should only be used for reading a file
-// or single object contained in an io.Reader. We will use a bufio.Reader
-// underneath, so this reader is not usable after.
-func UnmarshalJSON(r io.Reader) (Directory, error) {
-	var b *bufio.Reader
-	if _, ok := r.(*bufio.Reader); ok {
-		b = r.(*bufio.Reader)
-	} else {
-		b = readerPool.Get().(*bufio.Reader)
-		b.Reset(r)
+// DecodeOption is an optional argument to the Unmarshal functions.
+type DecodeOption func(o *decodeOptions)
+
+type decodeOptions struct {
+	duplicates      DuplicatePolicy
+	duplicateReport func(Duplicate)
+	limits          Limits
+	relaxed         bool
+	nonFinite       bool
+	// paths are the patterns from WithPaths(), split into their parts.
+	paths [][]string
+	// lazy is set by WithLazy().
+	lazy bool
+	// copy is set by WithCopy().
+	copy bool
+	// workers, unordered and buffer are set by WithWorkers(), WithUnordered()
+	// and WithBuffer().
+	workers   int
+	unordered bool
+	buffer    int
+	// skipErrors and summary are set by WithSkipErrors().
+	skipErrors bool
+	summary    *StreamSummary
+	// poll is set by WithPollInterval().
+	poll time.Duration
+}
+
+// newDecodeOptions applies options to the default decodeOptions.
+func newDecodeOptions(options []DecodeOption) decodeOptions {
+	opts := decodeOptions{}
+	for _, o := range options {
+		o(&opts)
 	}
-	defer func() { readerPool.Put(b) }()
+	return opts
+}
+
+// DuplicatePolicy is what to do when a key is repeated in a JSON object.
+type DuplicatePolicy uint8
+
+const (
+	// DuplicateError causes decoding to fail with a *SyntaxError. This is the default.
+	DuplicateError DuplicatePolicy = 0
+	// DuplicateFirstWins keeps the first value for the key and discards the rest.
+	DuplicateFirstWins DuplicatePolicy = 1
+	// DuplicateLastWins keeps the last value for the key. This is what encoding/json does.
+	DuplicateLastWins DuplicatePolicy = 2
+	// DuplicateCollect puts all the values for the key in an array, in the order they
+	// were found. A key that is not repeated is not put in an array.
+	DuplicateCollect DuplicatePolicy = 3
+)
 
-	m := dictPool.Get()
-	m.V.reset(b, "")
-	defer m.Close()
+// Duplicate describes a repeated key in a JSON object.
+type Duplicate struct {
+	// Key is the key that was repeated.
+	Key string
+	// Path is a JSON Pointer (RFC 6901) to the key, such as /items/42/id.
+	Path string
+	// Offset is the offset of the repeated key in the input.
+	Offset int64
+	// Line is the line number of the repeated key, starting at 1.
+	Line int
+	// Column is the byte position of the repeated key in Line, starting at 1.
+	Column int
+}
 
-	runSM(context.Background(), m.V.start)
-	if m.V.err != nil {
-		return Directory{}, m.V.err
+// WithDuplicates sets what to do when a key is repeated in a JSON object.
+// The default is DuplicateError.
+func WithDuplicates(policy DuplicatePolicy) DecodeOption {
+	return func(o *decodeOptions) {
+		o.duplicates = policy
 	}
-	return m.V.dir, nil
 }
 
-// Stream is a stream object from UnmarshalStream().
-type Stream struct {
-	// Dir is the JSON object as a Directory.
-	Dir Directory
-	// Err indicates that there was an error in the stream.
-	Err error
+// Limits are limits on the input, used to protect against malicious or broken
+// input when decoding data from untrusted sources. A zero value for any field
+// means there is no limit. If a limit is exceeded, a *LimitError is returned.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of objects and arrays. A top level
+	// object or array is at depth 1.
+	MaxDepth int
+	// MaxBytes is the maximum size in bytes of a JSON value. With UnmarshalStream()
+	// this applies to each value and with UnmarshalArrayStream() to each element.
+	MaxBytes int64
+	// MaxStringLen is the maximum size in bytes of a string or object key, before
+	// escape sequences are decoded.
+	MaxStringLen int
+	// MaxKeys is the maximum number of keys in an object.
+	MaxKeys int
+	// MaxArrayLen is the maximum number of elements in an array.
+	MaxArrayLen int
 }
 
-// UnmarshalStream unmarshals a stream of JSON objects from a reader.
-// This will handle both streams of objects.
-func UnmarshalStream(ctx context.Context, r io.Reader) chan Stream {
-	var b *bufio.Reader
-	if _, ok := r.(*bufio.Reader); ok {
-		b = r.(*bufio.Reader)
-	} else {
-		b = readerPool.Get().(*bufio.Reader)
-		b.Reset(r)
+// WithLimits sets limits on the input. You should always set these when
+// decoding untrusted input, as by default the size and depth of the input
+// is only limited by the available memory.
+func WithLimits(limits Limits) DecodeOption {
+	return func(o *decodeOptions) {
+		o.limits = limits
 	}
-	ch := make(chan Stream, 1)
-
-	go func() {
-		defer close(ch)
-		for {
-			dir, err := UnmarshalJSON(b)
-			if err != nil {
-				ch <- Stream{Err: err}
-				return
-			}
-			if dir.name == "" && len(dir.objs) == 0 {
-				return
-			}
-			ch <- Stream{Dir: dir}
-		}
-	}()
-	return ch
 }
 
-// runSM runs a statemachine starting at stateFn start.
-func runSM(ctx context.Context, start stateFn) {
-	current := start
-	for {
-		fn := current(ctx)
-		if fn == nil {
-			return
-		}
-		current = fn
+// WithRelaxed allows input with the common JSONC and JSON5 extensions that
+// are found in hand edited config files:
+//   - // and /* */ comments
+//   - trailing commas in objects and arrays
+//   - single quoted strings and object keys
+//   - unquoted object keys that are identifiers, such as {name: "value"}
+//   - hex numbers such as 0x1F, which are converted to decimal
+//
+// Marshaling always produces strict JSON, so comments are not kept.
+func WithRelaxed() DecodeOption {
+	return func(o *decodeOptions) {
+		o.relaxed = true
 	}
 }
 
-// dictSM handles JSON objects.
-type dictSM struct {
-	b         *bufio.Reader
-	dir       Directory
-	modTime   time.Time
-	valueName string
-	err       error
+// WithNonFinite allows the numbers Infinity, -Infinity and NaN, which are stored
+// as an FTFloat. This can be used with or without WithRelaxed(). These cannot be
+// represented in JSON, so marshaling a File holding one is an error.
+func WithNonFinite() DecodeOption {
+	return func(o *decodeOptions) {
+		o.nonFinite = true
+	}
 }
 
-// newDictSM creates a new dictSM statemachine.
-func newDictSM(b *bufio.Reader, dirName string) *dictSM {
-	return &dictSM{
-		b:   b,
-		dir: newDir(dirName, time.Time{}), // Directory.modTime set in start()
+// WithDuplicateReport causes report to be called for every repeated key that
+// does not cause an error. With the stream functions, report is called from
+// the decoding goroutine.
+func WithDuplicateReport(report func(Duplicate)) DecodeOption {
+	return func(o *decodeOptions) {
+		o.duplicateReport = report
 	}
 }
 
-func (m *dictSM) reset(b *bufio.Reader, dirName string) {
-	m.valueName = ""
-	m.err = nil
-	m.b = b
-	m.dir = newDir(dirName, time.Time{})
+// UnmarshalJSON unmarshals a single JSON object or array from an io.Reader.
+// This should only be used for reading a file or single object contained in
+// an io.Reader. We will use a bufio.Reader underneath, so this reader is not
+// usable after. If the JSON may be a basic value such as a string or number,
+// use UnmarshalValue().
+func UnmarshalJSON(r io.Reader, options ...DecodeOption) (Directory, error) {
+	return UnmarshalJSONContext(context.Background(), r, options...)
 }
 
-// start is the entry way into the messageSm.
-func (m *dictSM) start(ctx context.Context) stateFn {
-	m.modTime = time.Now()
-	m.dir.modTime = m.modTime
-	return m.openBrace
+// UnmarshalJSONContext is like UnmarshalJSON(), but decoding stops with a
+// *CanceledError if ctx is canceled or its deadline passes.
+func UnmarshalJSONContext(ctx context.Context, r io.Reader, options ...DecodeOption) (Directory, error) {
+	return unmarshalJSON(ctx, r, nil, options)
 }
 
-// openBrace handles the open brace.
-func (m *dictSM) openBrace(ctx context.Context) stateFn {
-	skipSpace(m.b)
+// unmarshalJSON implements UnmarshalJSONContext(). input is set if it holds
+// all of r, see decoder.input.
+func unmarshalJSON(ctx context.Context, r io.Reader, input []byte, options []DecodeOption) (Directory, error) {
+	b := bufioReader(r)
+	defer putReader(b, r)
 
-	r, _, err := m.b.ReadRune()
-	if err != nil {
-		if err == io.EOF {
-			return nil
-		}
-		m.err = err
-		return nil
+	if err := checkCtx(ctx); err != nil {
+		return Directory{}, err
 	}
 
-	if r != openBrace {
-		m.err = fmt.Errorf("object must start with {")
-		return nil
-	}
+	d := newDecoder(b, newDecodeOptions(options))
+	defer d.close()
+	d.input = input
 
-	// Special case, empty object {}
-	b, err := m.b.Peek(1)
-	if err != nil {
-		m.err = err
-		return nil
-	}
-	if rune(b[0]) == '}' {
-		m.b.ReadRune()
-		return nil
+	if d.opts.lazy {
+		return unmarshalLazy(ctx, d)
 	}
 
-	return m.parseKey
+	d.startValue()
+	if x, err := d.Peek(1); err == nil && x[0] == openBracket {
+		return decodeArray(ctx, d, "", time.Now())
+	}
+	return decodeDict(ctx, d, "")
 }
 
-// parseKey parses an object key.
-func (m *dictSM) parseKey(ctx context.Context) stateFn {
-	skipSpace(m.b)
+// UnmarshalBytes is like UnmarshalJSON(), but decodes JSON that is already in
+// memory, such as an HTTP body or a memory mapped file. The values of the Files
+// in the Directory point into data instead of being copied, so data must not
+// be changed while the Directory or anything from it is in use. Strings with
+// escape sequences, numbers changed by WithRelaxed() and object keys are
+// copied. Use WithCopy() to copy every value, which makes data free to reuse
+// once this returns.
+func UnmarshalBytes(data []byte, options ...DecodeOption) (Directory, error) {
+	return unmarshalJSON(context.Background(), bytes.NewReader(data), data, options)
+}
 
-	r, _, err := m.b.ReadRune()
-	if err != nil {
-		m.err = err
-		return nil
+// WithCopy causes UnmarshalBytes() to copy the values out of the input, like
+// UnmarshalJSON() does.
+func WithCopy() DecodeOption {
+	return func(o *decodeOptions) {
+		o.copy = true
 	}
+}
 
-	if r != '"' {
-		m.err = fmt.Errorf("object key expected but did not find open double quote(\"), found %v", r)
-		return nil
-	}
-	m.b.UnreadRune()
-	s, err := getString(m.b, true)
+// UnmarshalValue unmarshals any single JSON value from an io.Reader. This
+// returns a Directory for a JSON object or array and a File for any other
+// value, such as a top level string or number. The File or Directory will
+// have an empty name. If the reader only contains whitespace, io.EOF is returned.
+// Anything but whitespace after the value is a *SyntaxError.
+// Like UnmarshalJSON(), the reader is not usable after.
+func UnmarshalValue(r io.Reader, options ...DecodeOption) (FileOrDir, error) {
+	b := bufioReader(r)
+	defer putReader(b, r)
+
+	d := newDecoder(b, newDecodeOptions(options))
+	defer d.close()
+
+	d.startValue()
+	v, err := decodeValue(context.Background(), d, "")
 	if err != nil {
-		m.err = err
-		return nil
+		return nil, err
 	}
-	m.valueName = ByteSlice2String(s)
-
-	return m.colon
+	d.byteLimit = math.MaxInt64 // Space after the value is not part of it.
+	skipSpace(d)
+	switch _, err := d.Peek(1); {
+	case err == nil:
+		return nil, d.syntaxError(fmt.Errorf("invalid character %q after top-level value", d.peekRune()))
+	case err != io.EOF:
+		return nil, d.syntaxError(err)
+	}
+	return v, nil
 }
 
-// colon parses the colon after an object key.
-func (m *dictSM) colon(ctx context.Context) stateFn {
-	skipSpace(m.b)
-
-	r, _, err := m.b.ReadRune()
+// decodeValue decodes the next JSON value in d, which will be named name.
+// If there is only whitespace left in d, io.EOF is returned.
+func decodeValue(ctx context.Context, d *decoder, name string) (FileOrDir, error) {
+	next, err := valueCheck(d)
 	if err != nil {
-		m.err = err
-		return nil
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, d.syntaxError(err)
 	}
 
-	if r != ':' {
-		m.err = fmt.Errorf("object key not followed by colon :, was %q", r)
-		return nil
+	modTime := time.Now()
+	var f File
+	switch next {
+	case msgNext:
+		return decodeDict(ctx, d, name)
+	case arrayNext:
+		return decodeArray(ctx, d, name, modTime)
+	case stringNext:
+		f, err = decodeString(d, name, modTime)
+	case trueNext, falseNext:
+		f, err = decodeBool(d, name, next, modTime)
+	case numNext:
+		f, err = decodeNumber(d, name, modTime)
+	case nullNext:
+		f, err = decodeNull(d, name, modTime)
+	default:
+		err = fmt.Errorf("unexpected value type, got %v", next)
 	}
+	if err != nil {
+		return nil, d.syntaxError(err)
+	}
+	return f, nil
+}
 
-	return m.valueCheck
+// decodeDict decodes a JSON object named name from d.
+func decodeDict(ctx context.Context, d *decoder, name string) (Directory, error) {
+	return decodeDir(ctx, d, name, false, time.Time{})
 }
 
-// valueCheck tries to determine the value of an object key so that we
-// can go to the next state to handle it.
-func (m *dictSM) valueCheck(ctx context.Context) stateFn {
-	skipSpace(m.b)
+// decodeArray decodes a JSON array named name from d.
+func decodeArray(ctx context.Context, d *decoder, name string, modTime time.Time) (Directory, error) {
+	return decodeDir(ctx, d, name, true, modTime)
+}
+
+// decodeDir decodes a JSON object or array named name from d.
+func decodeDir(ctx context.Context, d *decoder, name string, array bool, modTime time.Time) (Directory, error) {
+	p := parserPool.Get()
+	defer p.Close()
+	p.V.reset(d)
+	defer p.V.reset(nil) // Do not keep what was decoded alive in the pool.
 
-	next, err := valueCheck(m.b)
+	err := p.V.push(name, array, modTime, d.rootFilter())
+	if err == nil {
+		err = p.V.run(ctx)
+	}
 	if err != nil {
-		m.err = err
-		return nil
+		return Directory{}, d.syntaxError(err)
 	}
+	return p.V.result, nil
+}
 
-	if err := duplicateField(m.dir, m.valueName); err != nil {
-		m.err = err
-		return nil
-	}
+// parseState is what a parser expects to read next in the object or array on
+// top of its stack.
+type parseState uint8
 
-	switch next {
-	case msgNext:
-		nm := dictPool.Get()
-		nm.V.reset(m.b, m.valueName)
+const (
+	// parseOpenBrace is the open brace of an object.
+	parseOpenBrace parseState = iota
+	// parseKey is an object key and the colon after it.
+	parseKey
+	// parseDictValue is the value of an object key.
+	parseDictValue
+	// parseDictCommaClose is the comma or close brace after an object value.
+	parseDictCommaClose
+	// parseOpenBracket is the open bracket of an array.
+	parseOpenBracket
+	// parseArrayValue is an element of an array.
+	parseArrayValue
+	// parseArrayCommaClose is the comma or close bracket after an array element.
+	parseArrayCommaClose
+)
 
-		runSM(ctx, nm.V.start)
-		if nm.V.err != nil {
-			m.err = nm.V.err
-			return nil
-		}
+// frame is an object or array being decoded by a parser.
+type frame struct {
+	dir     Directory
+	modTime time.Time
 
-		m.dir.objs[nm.V.dir.name] = Object{Type: OTDir, Dir: nm.V.dir}
-		nm.Close()
-		return m.commaClose
-	case arrayNext:
-		na := arrayPool.Get()
-		na.V.reset(m.b, m.valueName, m.modTime)
+	// valueName is the key or index of the value being decoded.
+	valueName string
+	// item is the index in the input of the next array element.
+	item int
+
+	// keyOffset, keyLine and keyColumn are the position of the key named valueName.
+	keyOffset          int64
+	keyLine, keyColumn int
+	// dup is set if valueName is already in dir.
+	dup bool
+	// collected holds keys whose values have been put in an array by DuplicateCollect.
+	collected map[string]bool
+
+	// filter is used to skip values that do not match WithPaths() and child
+	// is the pathFilter of the value being decoded.
+	filter, child pathFilter
+}
 
-		runSM(ctx, na.V.start)
-		if na.V.err != nil {
-			m.err = na.V.err
-			return nil
-		}
+// parser decodes JSON objects and arrays. The objects and arrays being decoded
+// are kept on a stack instead of being decoded with recursive calls, so deep
+// nesting costs heap memory instead of goroutine stack.
+type parser struct {
+	b     *decoder
+	stack []frame
+	state parseState
 
-		m.dir.objs[na.V.dir.name] = Object{Type: OTDir, Dir: na.V.dir}
-		na.Close()
-		return m.commaClose
-	case stringNext:
-		o, err := decodeString(m.b, m.valueName, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
-		}
-		m.dir.objs[m.valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case trueNext:
-		o, err := decodeBool(m.b, m.valueName, trueNext, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
-		}
-		m.dir.objs[m.valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case falseNext:
-		o, err := decodeBool(m.b, m.valueName, falseNext, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
-		}
-		m.dir.objs[m.valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case numNext:
-		o, err := decodeNumber(m.b, m.valueName, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
+	// result is the object or array that was decoded.
+	result Directory
+}
+
+func (p *parser) reset(b *decoder) {
+	for i := range p.stack {
+		p.stack[i] = frame{}
+	}
+	p.stack = p.stack[:0]
+	p.b = b
+	p.result = Directory{}
+}
+
+// top returns the object or array being decoded. It is only valid until the
+// next push().
+func (p *parser) top() *frame {
+	return &p.stack[len(p.stack)-1]
+}
+
+// run decodes until the object or array at the bottom of the stack is done.
+func (p *parser) run(ctx context.Context) error {
+	for len(p.stack) > 0 {
+		var err error
+		switch p.state {
+		case parseOpenBrace:
+			err = p.openBrace()
+		case parseKey:
+			err = p.key()
+		case parseDictValue:
+			err = p.dictValue(ctx)
+		case parseDictCommaClose:
+			err = p.commaClose(closeBrace, parseKey)
+		case parseOpenBracket:
+			err = p.openBracket()
+		case parseArrayValue:
+			err = p.arrayValue(ctx)
+		case parseArrayCommaClose:
+			err = p.commaClose(closeBracket, parseArrayValue)
 		}
-		m.dir.objs[m.valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case nullNext:
-		o, err := decodeNull(m.b, m.valueName, m.modTime)
 		if err != nil {
-			m.err = err
-			return nil
+			return err
 		}
-		m.dir.objs[m.valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
+	}
+	return nil
+}
+
+// push starts decoding an object or array named name, which is next in the
+// input.
+func (p *parser) push(name string, array bool, modTime time.Time, filter pathFilter) error {
+	if err := checkDepth(p.b); err != nil {
+		return err
 	}
 
-	m.err = fmt.Errorf("unexpected value type after key, got %v", next)
+	f := frame{dir: newDir(name, time.Time{}), modTime: modTime, filter: filter}
+	if array {
+		f.dir.isArray = true
+		p.state = parseOpenBracket
+	} else {
+		f.modTime = time.Now()
+		f.dir.modTime = f.modTime
+		p.state = parseOpenBrace
+	}
+	p.stack = append(p.stack, f)
 	return nil
 }
 
-// commaClose determines if we have another field in an object or object closure.
-func (m *dictSM) commaClose(ctx context.Context) stateFn {
-	skipSpace(m.b)
+// pop finishes the object or array on top of the stack and stores it in the
+// one below it, if there is one.
+func (p *parser) pop() error {
+	done := p.stack[len(p.stack)-1].dir
+	p.stack[len(p.stack)-1] = frame{}
+	p.stack = p.stack[:len(p.stack)-1]
+	if len(p.stack) == 0 {
+		p.result = done
+		return nil
+	}
 
-	x, err := m.b.Peek(1)
-	if err != nil {
-		m.err = fmt.Errorf("expecting comma after object or closing brace, found eol")
+	f := p.top()
+	p.b.dropFilter(f.child)
+	if f.child.on && len(done.objs) == 0 { // Nothing in it matched WithPaths().
+		p.afterValue(f)
 		return nil
 	}
-	r := rune(x[0])
+	return p.store(f, Object{Type: OTDir, Dir: done})
+}
 
-	switch r {
-	case closeBrace:
-		return m.braceClose
-	case comma:
-		return m.comma
+// afterValue sets the state to read what is after a value in f.
+func (p *parser) afterValue(f *frame) {
+	if f.dir.isArray {
+		p.state = parseArrayCommaClose
+		return
 	}
-	m.err = fmt.Errorf("expecting a comma after field value or closing brace, got %v", string(r))
-	return nil
+	p.state = parseDictCommaClose
 }
 
-// braceClose handles a closing brace(}) of an object.
-func (m *dictSM) braceClose(ctx context.Context) stateFn {
-	r, _, err := m.b.ReadRune()
+// openBrace handles the open brace.
+func (p *parser) openBrace() error {
+	skipSpace(p.b)
+
+	c, err := p.b.ReadByte()
 	if err != nil {
-		m.err = err
-		return nil
+		if err == io.EOF {
+			return p.pop()
+		}
+		return err
 	}
-	if r != closeBrace {
-		m.err = fmt.Errorf("expecting close brace, got %q", r)
-		return nil
+
+	if c != openBrace {
+		p.b.UnreadByte()
+		return fmt.Errorf("object must start with {, found %q", p.b.peekRune())
 	}
 
+	// Special case, empty object {}
+	empty, err := closeNext(p.b, closeBrace)
+	switch {
+	case err != nil:
+		return err
+	case empty:
+		p.b.ReadByte()
+		return p.pop()
+	}
+
+	p.state = parseKey
 	return nil
 }
 
-// comma handles a comma after a field value of an object.
-func (m *dictSM) comma(ctx context.Context) stateFn {
-	r, _, err := m.b.ReadRune()
+// key parses an object key and the colon after it.
+func (p *parser) key() error {
+	ident, err := keyStart(p.b)
 	if err != nil {
-		m.err = err
-		return nil
+		return err
 	}
-	if r != comma {
-		m.err = fmt.Errorf("expecting comma, got %q", r)
-		return nil
+
+	f := p.top()
+	f.keyOffset, f.keyLine, f.keyColumn = p.b.pos()
+	var s []byte
+	if ident {
+		s, err = getIdentifier(p.b)
+	} else {
+		s, err = getString(p.b, true)
 	}
-	return m.parseKey
-}
+	if err != nil {
+		return err
+	}
+	f.valueName = ByteSlice2String(s)
 
-type arraySM struct {
-	b       *bufio.Reader
-	dir     Directory
-	modTime time.Time
-	item    int
-	err     error
+	if err := keyEnd(p.b); err != nil {
+		return err
+	}
+	p.state = parseDictValue
+	return nil
 }
 
-func newArray(b *bufio.Reader, name string, modTime time.Time) *arraySM {
-	a := &arraySM{
-		b:       b,
-		dir:     newDir(name, modTime),
-		modTime: modTime,
+// dictValue determines the type of the value of an object key and decodes it.
+// An object or array is pushed onto the stack.
+func (p *parser) dictValue(ctx context.Context) error {
+	if err := checkCtx(ctx); err != nil {
+		return err
 	}
-	a.dir.isArray = true
-	return a
-}
 
-func (m *arraySM) reset(b *bufio.Reader, name string, modTime time.Time) {
-	m.b = b
-	m.dir = newDir(name, modTime)
-	m.dir.isArray = true
-	m.modTime = modTime
-	m.item = 0
-	m.err = nil
-}
+	f := p.top()
+	p.b.pushPath(f.valueName)
+	next, err := valueCheck(p.b)
+	if err != nil {
+		return err
+	}
 
-func (m *arraySM) start(ctx context.Context) stateFn {
-	return m.openBracket
+	f.child = pathFilter{}
+	if f.filter.on {
+		var keep bool
+		if keep, f.child = p.b.filterChild(f.filter, next, false); !keep {
+			if err := skipValue(p.b); err != nil {
+				return err
+			}
+			p.state = parseDictCommaClose
+			return nil
+		}
+	}
+
+	_, f.dup = f.dir.objs[f.valueName]
+	if max := p.b.opts.limits.MaxKeys; !f.dup && max > 0 && len(f.dir.objs) >= max {
+		return p.b.limitError("MaxKeys", int64(max))
+	}
+	if f.dup {
+		if p.b.opts.duplicates == DuplicateError {
+			return fmt.Errorf("had duplicate field named %q", f.valueName)
+		}
+		if p.b.opts.duplicateReport != nil {
+			p.b.opts.duplicateReport(Duplicate{
+				Key:    f.valueName,
+				Path:   p.b.pathString(),
+				Offset: f.keyOffset,
+				Line:   f.keyLine,
+				Column: f.keyColumn,
+			})
+		}
+	}
+
+	return p.value(f, next)
 }
 
-func (m *arraySM) openBracket(ctx context.Context) stateFn {
-	skipSpace(m.b)
+// arrayValue determines the type of the next array element and decodes it.
+// An object or array is pushed onto the stack.
+func (p *parser) arrayValue(ctx context.Context) error {
+	if err := checkCtx(ctx); err != nil {
+		return err
+	}
+
+	f := p.top()
+	item := f.item
+	f.item++
+	f.valueName = strconv.Itoa(item)
 
-	r, _, err := m.b.ReadRune()
+	p.b.pushPath(f.valueName)
+	if max := p.b.opts.limits.MaxArrayLen; max > 0 && item >= max {
+		return p.b.limitError("MaxArrayLen", int64(max))
+	}
+	next, err := valueCheck(p.b)
 	if err != nil {
-		m.err = err
-		return nil
+		return err
 	}
 
-	if r != openBracket {
-		m.err = fmt.Errorf("expected array open bracket, found %q", r)
-		return nil
+	f.child = pathFilter{}
+	if f.filter.on {
+		var keep bool
+		if keep, f.child = p.b.filterChild(f.filter, next, true); !keep {
+			if err := skipValue(p.b); err != nil {
+				return err
+			}
+			p.state = parseArrayCommaClose
+			return nil
+		}
+		f.valueName = strconv.Itoa(len(f.dir.objs)) // Kept values are numbered from 0.
+	}
+
+	return p.value(f, next)
+}
+
+// value decodes the value named f.valueName that is next in the input, which
+// is of type next.
+func (p *parser) value(f *frame, next next) error {
+	var o File
+	var err error
+	switch next {
+	case msgNext, arrayNext:
+		if p.b.lazy {
+			dir, err := lazyChild(p.b, f.valueName, f.modTime)
+			if err != nil {
+				return err
+			}
+			return p.store(f, Object{Type: OTDir, Dir: dir})
+		}
+		return p.push(f.valueName, next == arrayNext, f.modTime, f.child)
+	case stringNext:
+		o, err = decodeString(p.b, f.valueName, f.modTime)
+	case trueNext, falseNext:
+		o, err = decodeBool(p.b, f.valueName, next, f.modTime)
+	case numNext:
+		o, err = decodeNumber(p.b, f.valueName, f.modTime)
+	case nullNext:
+		o, err = decodeNull(p.b, f.valueName, f.modTime)
+	default:
+		if f.dir.isArray {
+			return fmt.Errorf("unexpected array value type got %v", next)
+		}
+		return fmt.Errorf("unexpected value type after key, got %v", next)
 	}
-	// Special case, empty array []
-	b, err := m.b.Peek(1)
 	if err != nil {
-		m.err = err
-		return nil
+		return err
 	}
-	if rune(b[0]) == ']' {
-		m.b.ReadRune()
+	return p.store(f, Object{Type: OTFile, File: o})
+}
+
+// store stores o in f under f.valueName. In an object, the DuplicatePolicy is
+// used if valueName has already been seen.
+func (p *parser) store(f *frame, o Object) error {
+	p.afterValue(f)
+	if !f.dup {
+		f.dir.objs[f.valueName] = o
+		if !f.dir.isArray {
+			*f.dir.order = append(*f.dir.order, f.valueName)
+		}
 		return nil
 	}
 
-	return m.valueCheck
+	switch p.b.opts.duplicates {
+	case DuplicateFirstWins:
+	case DuplicateLastWins:
+		f.dir.objs[f.valueName] = o
+	case DuplicateCollect:
+		prev := f.dir.objs[f.valueName]
+		if f.collected[f.valueName] {
+			name := strconv.Itoa(len(prev.Dir.objs))
+			prev.Dir.objs[name] = renameObject(o, name)
+			break
+		}
+		arr := newDir(f.valueName, f.modTime)
+		arr.isArray = true
+		arr.objs["0"] = renameObject(prev, "0")
+		arr.objs["1"] = renameObject(o, "1")
+		f.dir.objs[f.valueName] = Object{Type: OTDir, Dir: arr}
+		if f.collected == nil {
+			f.collected = map[string]bool{}
+		}
+		f.collected[f.valueName] = true
+	default:
+		return fmt.Errorf("unknown DuplicatePolicy %d", p.b.opts.duplicates)
+	}
+	return nil
 }
 
-func (m *arraySM) valueCheck(ctx context.Context) stateFn {
-	defer func() { m.item++ }()
+// renameObject returns o with the File or Directory renamed to name.
+func renameObject(o Object, name string) Object {
+	switch o.Type {
+	case OTFile:
+		o.File.name = name
+	case OTDir:
+		o.Dir.name = name
+	}
+	return o
+}
 
-	skipSpace(m.b)
+// commaClose handles what is after a value in an object or array, which is a
+// comma or close, the close brace or bracket. After a comma, the state is set
+// to more.
+func (p *parser) commaClose(close byte, more parseState) error {
+	p.b.popPath() // We are done with the value.
 
-	next, err := valueCheck(m.b)
+	member, err := nextMember(p.b, close)
 	if err != nil {
-		m.err = err
+		return err
+	}
+	if member {
+		p.state = more
 		return nil
 	}
+	p.b.ReadByte() // The close, which nextMember() found.
+	return p.pop()
+}
 
-	valueName := strconv.Itoa(m.item)
+// openBracket handles the open bracket.
+func (p *parser) openBracket() error {
+	skipSpace(p.b)
 
-	switch next {
-	case msgNext:
-		nm := dictPool.Get()
-		nm.V.reset(m.b, strconv.Itoa(m.item))
+	c, err := p.b.ReadByte()
+	if err != nil {
+		return err
+	}
 
-		runSM(ctx, nm.V.start)
-		if nm.V.err != nil {
-			m.err = nm.V.err
-			return nil
-		}
+	if c != openBracket {
+		p.b.UnreadByte()
+		return fmt.Errorf("expected array open bracket, found %q", p.b.peekRune())
+	}
+	// Special case, empty array []
+	empty, err := closeNext(p.b, closeBracket)
+	switch {
+	case err != nil:
+		return err
+	case empty:
+		p.b.ReadByte()
+		return p.pop()
+	}
 
-		m.dir.objs[nm.V.dir.name] = Object{Type: OTDir, Dir: nm.V.dir}
-		nm.Close()
-		return m.commaClose
-	case arrayNext:
-		na := arrayPool.Get()
-		na.V.reset(m.b, strconv.Itoa(m.item), m.modTime)
+	p.state = parseArrayValue
+	return nil
+}
 
-		runSM(ctx, na.V.start)
-		if na.V.err != nil {
-			m.err = na.V.err
-			return nil
-		}
+// checkDepth returns a *LimitError if starting an object or array at the
+// current path would exceed Limits.MaxDepth.
+func checkDepth(b *decoder) error {
+	if max := b.opts.limits.MaxDepth; max > 0 && len(b.path) >= max {
+		return b.limitError("MaxDepth", int64(max))
+	}
+	return nil
+}
 
-		m.dir.objs[na.V.dir.name] = Object{Type: OTDir, Dir: na.V.dir}
-		na.Close()
-		return m.commaClose
-	case stringNext:
-		o, err := decodeString(m.b, valueName, m.modTime)
+// jsonSpace holds the bytes that are whitespace in JSON (RFC 8259, section 2).
+var jsonSpace = [256]bool{' ': true, '\t': true, '\n': true, '\r': true}
+
+// json5Space holds the ASCII bytes that are whitespace in JSON5.
+var json5Space = [256]bool{' ': true, '\t': true, '\n': true, '\r': true, '\v': true, '\f': true}
+
+// skipSpace skips the whitespace in the reader. With WithRelaxed(), comments
+// and Unicode whitespace are skipped too.
+func skipSpace(b *decoder) {
+	space := &jsonSpace
+	if b.opts.relaxed {
+		space = &json5Space
+	}
+
+	for {
+		window, err := b.buffered()
 		if err != nil {
-			m.err = err
-			return nil
+			return
 		}
-		m.dir.objs[valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case trueNext:
-		o, err := decodeBool(m.b, valueName, trueNext, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
+		i := 0
+		for i < len(window) && space[window[i]] {
+			i++
 		}
-		m.dir.objs[valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case falseNext:
-		o, err := decodeBool(m.b, valueName, falseNext, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
+		if i == len(window) {
+			if b.discard(i) != nil {
+				return
+			}
+			continue
 		}
-		m.dir.objs[valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case numNext:
-		o, err := decodeNumber(m.b, valueName, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
+		c := window[i]
+		if i > 0 && b.discard(i) != nil {
+			return
 		}
-		m.dir.objs[valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
-	case nullNext:
-		o, err := decodeNull(m.b, valueName, m.modTime)
-		if err != nil {
-			m.err = err
-			return nil
+		if !b.opts.relaxed {
+			return
+		}
+
+		switch {
+		case c == '/':
+			if !skipComment(b) {
+				return
+			}
+		case c >= utf8.RuneSelf:
+			if !unicode.IsSpace(b.peekRune()) {
+				return
+			}
+			b.ReadRune()
+		default:
+			return
 		}
-		m.dir.objs[valueName] = Object{Type: OTFile, File: o}
-		return m.commaClose
 	}
+}
 
-	m.err = fmt.Errorf("unexpected array value type got %v", next)
-	return nil
+// trailingComma reports if the next non-space character is the close
+// character, which means the comma just read was a trailing comma.
+func trailingComma(b *decoder, close byte) bool {
+	skipSpace(b)
+	x, err := b.Peek(1)
+	return err == nil && x[0] == close
 }
 
-// commaClose determines if we have another field in an object or object closure.
-func (m *arraySM) commaClose(ctx context.Context) stateFn {
-	skipSpace(m.b)
+// The functions below read the parts of an object or array that are between
+// its values. The parser, Scanner and skipValue() all use them, so they check
+// the same things and give the same errors.
 
-	x, err := m.b.Peek(1)
+// closeNext reports if close, the close brace or bracket of an object or array
+// that was just opened, is next in b. It is not read.
+func closeNext(b *decoder, close byte) (bool, error) {
+	skipSpace(b)
+	x, err := b.Peek(1)
 	if err != nil {
-		m.err = fmt.Errorf("expecting comma after array value or closing bracket, found eol")
-		return nil
+		return false, err
 	}
-	r := rune(x[0])
+	return x[0] == close, nil
+}
 
-	switch r {
-	case closeBracket:
-		return m.close
-	case comma:
-		return m.comma
+// keyStart checks that an object key is next in b. It reports if the key is
+// an identifier, which WithRelaxed() allows, instead of a quoted string.
+func keyStart(b *decoder) (ident bool, err error) {
+	skipSpace(b)
+	x, err := b.Peek(1)
+	if err != nil {
+		return false, err
 	}
-	m.err = fmt.Errorf("expecting a comma after field value or closing bracket, got %v", string(r))
-	return nil
+	switch {
+	case x[0] == doubleQuote, x[0] == singleQuote && b.opts.relaxed:
+		return false, nil
+	case b.opts.relaxed && isIdentStart(b.peekRune()):
+		return true, nil
+	}
+	return false, fmt.Errorf("object key expected but did not find open double quote(\"), found %q", b.peekRune())
 }
 
-// close handles a closing bracket(]) of an array.
-func (m *arraySM) close(ctx context.Context) stateFn {
-	r, _, err := m.b.ReadRune()
+// keyEnd reads the colon after an object key.
+func keyEnd(b *decoder) error {
+	skipSpace(b)
+	c, err := b.ReadByte()
 	if err != nil {
-		m.err = err
-		return nil
+		return err
 	}
-	if r != closeBracket {
-		m.err = fmt.Errorf("expecting close bracket, got %q", r)
-		return nil
+	if c != colon {
+		b.UnreadByte()
+		return fmt.Errorf("object key not followed by colon :, was %q", b.peekRune())
 	}
-
 	return nil
 }
 
-// comma handles a comma after a field value of an object.
-func (m *arraySM) comma(ctx context.Context) stateFn {
-	r, _, err := m.b.ReadRune()
+// nextMember reads the comma after a value in an object or array that ends
+// with close. It reports if another key or element follows. If not, close is
+// next in b and has not been read.
+func nextMember(b *decoder, close byte) (bool, error) {
+	skipSpace(b)
+	c, err := b.ReadByte()
 	if err != nil {
-		m.err = err
-		return nil
+		return false, err
 	}
-	if r != comma {
-		m.err = fmt.Errorf("expecting comma, got %q", r)
-		return nil
+	switch {
+	case c == close:
+		b.UnreadByte()
+		return false, nil
+	case c != comma:
+		b.UnreadByte()
+		return false, fmt.Errorf("expecting a comma after value or closing %q, got %q", close, b.peekRune())
+	case b.opts.relaxed && trailingComma(b, close):
+		return false, nil
 	}
-	return m.valueCheck
+	return true, nil
 }
 
-// skipSpace skips all spaces in the reader.
-func skipSpace(b *bufio.Reader) {
-	for {
-		r, _, err := b.ReadRune()
-		if err != nil {
-			b.UnreadRune()
-			return
-		}
-		if unicode.IsSpace(r) {
-			continue
-		}
-		b.UnreadRune()
-		return
+// literal checks that the true, false or null that valueCheck() found as next
+// is in b and returns its length. It is not read.
+func literal(b *decoder, next next) (int, error) {
+	lit := "null"
+	switch next {
+	case trueNext:
+		lit = "true"
+	case falseNext:
+		lit = "false"
+	}
+
+	// Peek first so an error points at the start of the value.
+	x, _ := b.Peek(len(lit))
+	switch {
+	case ByteSlice2String(x) == lit:
+		return len(lit), nil
+	case next == nullNext:
+		return 0, fmt.Errorf("expected null, found %v", ByteSlice2String(x))
 	}
+	return 0, fmt.Errorf("expected bool value true or false, got %v", ByteSlice2String(x))
 }
 
 type next int
@@ -568,7 +902,7 @@ const (
 	nullNext
 )
 
-func valueCheck(b *bufio.Reader) (next, error) {
+func valueCheck(b *decoder) (next, error) {
 	skipSpace(b)
 
 	x, err := b.Peek(1)
@@ -584,7 +918,11 @@ func valueCheck(b *bufio.Reader) (next, error) {
 		return arrayNext, nil
 	case r == doubleQuote:
 		return stringNext, nil
-	case unicode.IsNumber(r):
+	case r == '-' || isDigit(byte(r)):
+		return numNext, nil
+	case r == singleQuote && b.opts.relaxed:
+		return stringNext, nil
+	case (r == 'I' || r == 'N') && b.opts.nonFinite:
 		return numNext, nil
 	// bool case
 	case r == 't':
@@ -596,11 +934,14 @@ func valueCheck(b *bufio.Reader) (next, error) {
 		return nullNext, nil
 	}
 
-	return 0, fmt.Errorf("unexpected value type after key, got %q after quote", r)
+	return 0, fmt.Errorf("unexpected value type after key, got %q after quote", b.peekRune())
 }
 
-func decodeString(b *bufio.Reader, name string, modTime time.Time) (File, error) {
-	s, err := getString(b, true)
+func decodeString(b *decoder, name string, modTime time.Time) (File, error) {
+	s, ok, err := inputString(b)
+	if !ok {
+		s, err = getString(b, true)
+	}
 	if err != nil {
 		return File{}, err
 	}
@@ -613,16 +954,50 @@ func decodeString(b *bufio.Reader, name string, modTime time.Time) (File, error)
 	}, nil
 }
 
+// inputString reads the string that is next in b and returns it without
+// copying it, if b.inMemory() and the string has no escape sequences. If it
+// cannot, it returns false and nothing is read.
+func inputString(b *decoder) ([]byte, bool, error) {
+	if !b.inMemory() {
+		return nil, false, nil
+	}
+	rest := b.input[b.offset-b.inputStart:]
+	if len(rest) == 0 {
+		return nil, false, nil
+	}
+	end := bytes.IndexByte(rest[1:], rest[0]) // rest[0] is the quote.
+	if end < 0 {
+		return nil, false, nil
+	}
+	if max := b.opts.limits.MaxStringLen; max > 0 && end > max {
+		return nil, false, nil
+	}
+	for _, c := range rest[1 : end+1] {
+		if c == backslash || c < 0x20 {
+			return nil, false, nil
+		}
+	}
+
+	s, err := b.inputBytes(end + 2)
+	if err != nil {
+		return nil, true, err
+	}
+	return s[1 : end+1 : end+1], true, nil
+}
+
 // decodeBool decodes a boolean value.
-func decodeBool(b *bufio.Reader, name string, hint next, modTime time.Time) (File, error) {
+func decodeBool(b *decoder, name string, hint next, modTime time.Time) (File, error) {
+	n, err := literal(b, hint)
+	if err != nil {
+		return File{}, err
+	}
 	var buff []byte
-	if hint == trueNext {
-		buff = make([]byte, 4) // escape
+	if b.inMemory() {
+		buff, err = b.inputBytes(n)
 	} else {
-		buff = make([]byte, 5) // escape
+		buff = make([]byte, n) // escape
+		_, err = io.ReadFull(b, buff)
 	}
-
-	_, err := io.ReadFull(b, buff)
 	if err != nil {
 		return File{}, fmt.Errorf("decoding bool, but unexpected error: %v", err)
 	}
@@ -647,10 +1022,18 @@ func decodeBool(b *bufio.Reader, name string, hint next, modTime time.Time) (Fil
 }
 
 // decodeNull decodes a null value.
-func decodeNull(b *bufio.Reader, name string, modTime time.Time) (File, error) {
-	buff := make([]byte, 4) // escape
-
-	_, err := io.ReadFull(b, buff)
+func decodeNull(b *decoder, name string, modTime time.Time) (File, error) {
+	if _, err := literal(b, nullNext); err != nil {
+		return File{}, err
+	}
+	var buff []byte
+	var err error
+	if b.inMemory() {
+		buff, err = b.inputBytes(4)
+	} else {
+		buff = make([]byte, 4) // escape
+		_, err = io.ReadFull(b, buff)
+	}
 	if err != nil {
 		return File{}, fmt.Errorf("decoding null, but unexpected error: %v", err)
 	}
@@ -667,67 +1050,346 @@ func decodeNull(b *bufio.Reader, name string, modTime time.Time) (File, error) {
 	}, nil
 }
 
-// decodeNumber decodes a number value.
-// TODO(jdoak): Doesn't handle the whole E or hex value stuff.
-func decodeNumber(b *bufio.Reader, name string, modTime time.Time) (File, error) {
-	buff := make([]byte, 0, 5) // escape
-	float := false
+// decodeNumber decodes a number value. The number must follow the JSON number
+// grammar in RFC 8259, section 6.
+func decodeNumber(b *decoder, name string, modTime time.Time) (File, error) {
+	var buff []byte
+	if b.inMemory() {
+		buff = b.skipBuff[:0] // Only copied below if it is not in the input.
+	} else {
+		buff = make([]byte, 0, 5) // escape
+	}
+	start := b.offset - b.inputStart
+	buff, t, err := appendNumber(buff, b)
+	if err != nil {
+		return File{}, err
+	}
+	if b.inMemory() {
+		b.skipBuff = buff
+		end := b.offset - b.inputStart
+		if in := b.input[start:end:end]; bytes.Equal(in, buff) {
+			buff = in
+		} else {
+			buff = append([]byte(nil), buff...)
+		}
+	}
+
+	switch t {
+	case FTInt, FTFloat:
+		t = numberClass(buff, t)
+	}
+
+	return File{
+		name:    name,
+		modTime: modTime,
+		value:   buff,
+		t:       t,
+	}, nil
+}
+
+// appendNumber reads a number from b and appends it to buff. The number is
+// checked, but only FTInt or FTFloat is returned, use numberClass() to find
+// out if it is an FTBigInt or FTDecimal. Infinity, -Infinity and NaN are
+// FTFloat and are only read if WithNonFinite() was used.
+func appendNumber(buff []byte, b *decoder) ([]byte, FileType, error) {
+	if b.opts.nonFinite {
+		if n := nonFiniteLen(b); n > 0 {
+			for i := 0; i < n; i++ {
+				c, err := b.ReadByte()
+				if err != nil {
+					return nil, 0, err
+				}
+				buff = append(buff, c)
+			}
+			return buff, FTFloat, nil
+		}
+	}
+
+	start := len(buff)
 	for {
-		r, _, err := b.ReadRune()
+		// We only read the number, so that the byte after it is not counted against Limits.MaxBytes.
+		window, err := b.buffered()
 		if err != nil {
-			return File{}, err
-		}
-		if !unicode.IsNumber(r) {
-			if r != '.' {
-				b.UnreadRune()
+			if err == io.EOF {
 				break
 			}
-			buff = append(buff, byte(r))
-			float = true
-			continue
+			return nil, 0, err
+		}
+		i := 0
+		for i < len(window) && (isNumberByte(window[i]) || b.opts.relaxed && isHexByte(window[i])) {
+			i++
 		}
-		buff = append(buff, byte(r))
+		buff = append(buff, window[:i]...)
+		if err := b.discard(i); err != nil {
+			return nil, 0, err
+		}
+		if i < len(window) {
+			break
+		}
+	}
+	if len(buff) == start {
+		return nil, 0, fmt.Errorf("expected key to have number, but did not")
 	}
-	if len(buff) == 0 {
-		return File{}, fmt.Errorf("expected key to have number, but did not")
+	if b.opts.relaxed {
+		n, err := hexToDecimal(buff[start:])
+		if err != nil {
+			return nil, 0, err
+		}
+		buff = append(buff[:start], n...)
 	}
 
-	o := File{
-		name:    name,
-		modTime: modTime,
-		value:   buff,
-		t:       FTInt,
+	t, err := checkNumber(buff[start:])
+	if err != nil {
+		// Point at the bad byte instead of after the number.
+		return nil, 0, b.syntaxErrorBack(err, int64(len(buff)-start-err.(*numberError).at))
 	}
-	if float {
-		o.t = FTFloat
+	return buff, t, nil
+}
+
+// isNumberByte reports if b can be part of a JSON number.
+func isNumberByte(b byte) bool {
+	switch {
+	case b >= '0' && b <= '9':
+		return true
+	case b == '-', b == '+', b == '.', b == 'e', b == 'E':
+		return true
 	}
-	return o, nil
+	return false
 }
 
-// getString gets a string from the Reader. If deleteFirst == true, the first
-// character is considered to be the quote character and is removed.
-// We handle escaping a quote with \.
-func getString(b *bufio.Reader, deleteFirst bool) ([]byte, error) {
-	if deleteFirst {
-		if _, _, err := b.ReadRune(); err != nil {
-			return nil, err
+// isDigit reports if b is an ASCII digit.
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// numberType validates that b is a JSON number as defined in RFC 8259:
+//
+//	number = [ minus ] int [ frac ] [ exp ]
+//	int    = zero / ( digit1-9 *DIGIT )
+//	frac   = decimal-point 1*DIGIT
+//	exp    = e [ minus / plus ] 1*DIGIT
+//
+// It returns FTInt if the number has no fraction or exponent, otherwise FTFloat.
+// If an integer will not fit in an int64, FTBigInt is returned. If a float
+// cannot round trip through a float64 without losing digits, FTDecimal is returned.
+func numberType(b []byte) (FileType, error) {
+	t, err := checkNumber(b)
+	if err != nil {
+		return 0, err
+	}
+	return numberClass(b, t), nil
+}
+
+// numberError is an error from checkNumber(). at is the index in the number of
+// the byte where the problem was found.
+type numberError struct {
+	msg string
+	at  int
+}
+
+func (e *numberError) Error() string {
+	return e.msg
+}
+
+// badNumber returns a *numberError for the byte at index at.
+func badNumber(at int, format string, a ...any) error {
+	return &numberError{msg: fmt.Sprintf(format, a...), at: at}
+}
+
+// checkNumber validates b like numberType(), but only returns FTInt or FTFloat.
+// Its errors are a *numberError.
+func checkNumber(b []byte) (FileType, error) {
+	i := 0
+	t := FTInt
+
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	switch {
+	case i == len(b):
+		return 0, badNumber(i, "invalid number %q: no digits", b)
+	case b[i] == '0':
+		i++
+		if i < len(b) && isDigit(b[i]) {
+			return 0, badNumber(i, "invalid number %q: leading zeros are not allowed", b)
+		}
+	case isDigit(b[i]):
+		for i < len(b) && isDigit(b[i]) {
+			i++
+		}
+	default:
+		return 0, badNumber(i, "invalid number %q: must start with a digit", b)
+	}
+
+	if i < len(b) && b[i] == '.' {
+		t = FTFloat
+		i++
+		start := i
+		for i < len(b) && isDigit(b[i]) {
+			i++
+		}
+		if i == start {
+			return 0, badNumber(i, "invalid number %q: decimal point must be followed by a digit", b)
+		}
+	}
+
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		t = FTFloat
+		i++
+		if i < len(b) && (b[i] == '-' || b[i] == '+') {
+			i++
 		}
+		start := i
+		for i < len(b) && isDigit(b[i]) {
+			i++
+		}
+		if i == start {
+			return 0, badNumber(i, "invalid number %q: exponent must have a digit", b)
+		}
+	}
+
+	if i != len(b) {
+		return 0, badNumber(i, "invalid number %q: unexpected character %q", b, b[i])
+	}
+	return t, nil
+}
+
+// numberClass returns FTBigInt or FTDecimal if the valid number b of type t,
+// which is FTInt or FTFloat, does not fit in an int64 or float64.
+func numberClass(b []byte, t FileType) FileType {
+	switch t {
+	case FTInt:
+		// An int64 has at most 19 digits, so anything shorter always fits.
+		digits := len(b)
+		if b[0] == '-' {
+			digits--
+		}
+		if digits >= 19 {
+			if _, err := strconv.ParseInt(ByteSlice2String(b), 10, 64); err != nil {
+				return FTBigInt
+			}
+		}
+	case FTFloat:
+		if !floatRoundTrips(b) {
+			return FTDecimal
+		}
+	}
+	return t
+}
+
+// floatRoundTrips reports if the number in b, which must be valid, would
+// be written back with the same digits after being converted to a float64.
+func floatRoundTrips(b []byte) bool {
+	// 15 significant digits always survive a float64, so short numbers
+	// without an exponent can skip the expensive check.
+	if len(b) <= 16 && bytes.IndexAny(b, "eE") == -1 {
+		return true
+	}
+
+	f, err := strconv.ParseFloat(ByteSlice2String(b), 64)
+	if err != nil {
+		return false
+	}
+	wantDigits, wantExp := decimalForm(b)
+	gotDigits, gotExp := decimalForm(UnsafeGetBytes(strconv.FormatFloat(f, 'e', -1, 64)))
+	return wantExp == gotExp && bytes.Equal(wantDigits, gotDigits)
+}
+
+// decimalForm converts a valid JSON number into its significant digits
+// and the exponent so that the absolute value is 0.digits x 10^exp. The
+// digits have no leading or trailing zeros. Zero returns nil digits.
+func decimalForm(b []byte) (digits []byte, exp int) {
+	var (
+		i         int
+		seenPoint bool
+		point     int
+	)
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+
+	digits = make([]byte, 0, len(b))
+	for ; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case isDigit(c):
+			if len(digits) == 0 && c == '0' {
+				if seenPoint {
+					point--
+				}
+				continue
+			}
+			digits = append(digits, c)
+			if !seenPoint {
+				point++
+			}
+			continue
+		case c == '.':
+			seenPoint = true
+			continue
+		}
+		break
+	}
+	if i < len(b) { // Exponent.
+		e, _ := strconv.Atoi(strings.TrimPrefix(ByteSlice2String(b[i+1:]), "+"))
+		point += e
 	}
 
-	s, err := b.ReadBytes('"')
+	digits = bytes.TrimRight(digits, "0")
+	if len(digits) == 0 {
+		return nil, 0
+	}
+	return digits, point
+}
+
+// getString gets a string from the Reader. If deleteFirst == true, the first
+// character is considered to be the quote character and is removed.
+// The returned string has had all escape sequences decoded.
+func getString(b *decoder, deleteFirst bool) ([]byte, error) {
+	s, err := getRawString(b, deleteFirst)
 	if err != nil {
-		return nil, fmt.Errorf("string did not end with a double quote: %s", err)
+		return nil, err
 	}
+	return unescape(s, b.opts.relaxed)
+}
+
+// getRawString is like getString, but does not decode escape sequences. We
+// only track escaped quotes to find the end of the string.
+func getRawString(b *decoder, deleteFirst bool) ([]byte, error) {
+	return appendRawString(nil, b, deleteFirst)
+}
 
-	if !isQuote(s) {
-		buff, err := getString(b, false)
+// appendRawString is like getRawString, but appends the string to s.
+func appendRawString(s []byte, b *decoder, deleteFirst bool) ([]byte, error) {
+	quote := byte(doubleQuote)
+	if deleteFirst {
+		c, err := b.ReadByte()
 		if err != nil {
 			return nil, err
 		}
-		return append(s, buff...), nil
+		if c == singleQuote {
+			quote = singleQuote
+		}
 	}
 
-	return s[:len(s)-1], nil
+	start := len(s)
+	for {
+		var err error
+		s, err = b.readBytes(s, start, quote, "MaxStringLen", b.opts.limits.MaxStringLen)
+		if err != nil {
+			if _, ok := err.(*LimitError); ok {
+				return nil, err
+			}
+			if quote == singleQuote {
+				return nil, fmt.Errorf("string did not end with a single quote: %s", err)
+			}
+			return nil, fmt.Errorf("string did not end with a double quote: %s", err)
+		}
+		// An escaped quote is part of the string, keep going.
+		if isQuote(s[start:]) {
+			return s[:len(s)-1], nil
+		}
+	}
 }
 
 const backslash = '\\'
@@ -765,13 +1427,6 @@ func isQuote(b []byte) bool {
 	return itIs
 }
 
-func duplicateField(dir Directory, name string) error {
-	if _, ok := dir.objs[name]; ok {
-		return fmt.Errorf("had duplicate field named %q", name)
-	}
-	return nil
-}
-
 // unsafeGetBytes extracts the []byte from a string. Use cautiously.
 func unsafeGetBytes(s string) []byte {
 	return (*[0x7fff0000]byte)(unsafe.Pointer(
@@ -1,12 +1,18 @@
 package jsonfs
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"log"
+	"math"
+	"math/big"
 	"strconv"
 	"strings"
 	"testing"
@@ -224,6 +230,343 @@ func TestLargeFile(t *testing.T) {
 	}
 }
 
+func TestUnmarshalValue(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		file  bool
+	}{
+		{input: ` [1, "a", {"b": []}, [true, null]] `, want: `[1,"a",{"b":[]},[true,null]]`},
+		{input: `[]`, want: `[]`},
+		{input: `{}`, want: `{}`},
+		{input: `{"a": [1, 2]}`, want: `{"a":[1,2]}`},
+		{input: ` "hello\tworld" `, want: `"hello\tworld"`, file: true},
+		{input: `-12.5e3`, want: `-12.5e3`, file: true},
+		{input: `true`, want: `true`, file: true},
+		{input: `null`, want: `null`, file: true},
+	}
+
+	for _, test := range tests {
+		v, err := UnmarshalValue(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("TestUnmarshalValue(%s): got err == %s, want err == nil", test.input, err)
+			continue
+		}
+		if _, ok := v.(File); ok != test.file {
+			t.Errorf("TestUnmarshalValue(%s): got %T, want File == %v", test.input, v, test.file)
+			continue
+		}
+
+		buff := &bytes.Buffer{}
+		if err := MarshalJSON(buff, v); err != nil {
+			t.Errorf("TestUnmarshalValue(%s): MarshalJSON had error: %s", test.input, err)
+			continue
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestUnmarshalValue(%s): got %s, want %s", test.input, buff.String(), test.want)
+		}
+	}
+
+	if _, err := UnmarshalValue(strings.NewReader(" \n ")); err != io.EOF {
+		t.Errorf("TestUnmarshalValue(whitespace): got err == %v, want io.EOF", err)
+	}
+
+	for _, input := range []string{"1 2", "truex", "[1] x", `{"a": 1}}`, `"s" "t"`} {
+		_, err := UnmarshalValue(strings.NewReader(input))
+		var sErr *SyntaxError
+		if !errors.As(err, &sErr) {
+			t.Errorf("TestUnmarshalValue(%s): got err == %v, want a *SyntaxError", input, err)
+		}
+	}
+
+	d, err := UnmarshalJSON(strings.NewReader(`[{"a": 1}, 2]`))
+	if err != nil {
+		t.Fatalf("TestUnmarshalValue: UnmarshalJSON of a top level array had error: %s", err)
+	}
+	if f, err := d.GetFile("0/a"); err != nil || f.IntOrZV() != 1 {
+		t.Errorf("TestUnmarshalValue: UnmarshalJSON of a top level array: could not get 0/a: %v", err)
+	}
+}
+
+// cancelReader cancels a Context after the first Read().
+type cancelReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (c *cancelReader) Read(b []byte) (int, error) {
+	defer c.cancel()
+	return c.r.Read(b)
+}
+
+func TestUnmarshalJSONContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := UnmarshalJSONContext(ctx, strings.NewReader(jsonText))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("TestUnmarshalJSONContext(already canceled): got err == %v, want context.Canceled", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	_, err = UnmarshalJSONContext(ctx, &cancelReader{r: strings.NewReader(largeJSON), cancel: cancel})
+	var cErr *CanceledError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("TestUnmarshalJSONContext(canceled during decode): got err == %v, want *CanceledError", err)
+	}
+	if cErr.Err != context.Canceled {
+		t.Errorf("TestUnmarshalJSONContext(canceled during decode): got CanceledError.Err == %v, want context.Canceled", cErr.Err)
+	}
+}
+
+func TestUnmarshalBytes(t *testing.T) {
+	for _, text := range []string{jsonText, largeJSON} {
+		want, err := UnmarshalJSON(strings.NewReader(text))
+		if err != nil {
+			t.Fatalf("TestUnmarshalBytes: UnmarshalJSON had error: %s", err)
+		}
+		got, err := UnmarshalBytes([]byte(text))
+		if err != nil {
+			t.Fatalf("TestUnmarshalBytes: got err == %s, want err == nil", err)
+		}
+		wantBuff, gotBuff := &bytes.Buffer{}, &bytes.Buffer{}
+		MarshalJSON(wantBuff, want)
+		MarshalJSON(gotBuff, got)
+		if gotBuff.String() != wantBuff.String() {
+			t.Errorf("TestUnmarshalBytes: did not give the same Directory as UnmarshalJSON()")
+		}
+	}
+
+	const text = `{"s": "abc", "e": "a\nb", "n": 12, "h": 0x1F, "b": true, "z": null, "a": ["def"]}`
+	tests := []struct {
+		desc    string
+		options []DecodeOption
+		// shared are the files that should point into the input.
+		shared []string
+	}{
+		{desc: "zero copy", shared: []string{"s", "n", "b", "z", "a/0"}},
+		{desc: "WithCopy", options: []DecodeOption{WithCopy()}},
+		{desc: "WithLazy", options: []DecodeOption{WithLazy()}, shared: []string{"s", "n", "b", "z", "a/0"}},
+		{desc: "WithLazy and WithCopy", options: []DecodeOption{WithLazy(), WithCopy()}},
+	}
+
+	for _, test := range tests {
+		data := []byte(text)
+		d, err := UnmarshalBytes(data, append(test.options, WithRelaxed())...)
+		if err != nil {
+			t.Errorf("TestUnmarshalBytes(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		shared := map[string]bool{}
+		for _, name := range test.shared {
+			shared[name] = true
+		}
+		names := []string{"s", "e", "n", "h", "b", "z", "a/0"}
+		files := make([]File, 0, len(names))
+		before := make([]string, 0, len(names))
+		for _, name := range names {
+			f, err := d.GetFile(name)
+			if err != nil {
+				t.Fatalf("TestUnmarshalBytes(%s): GetFile(%s) had error: %s", test.desc, name, err)
+			}
+			if shared[name] && cap(f.value) != len(f.value) {
+				t.Errorf("TestUnmarshalBytes(%s): %s: cap(value) is %d, want %d so appends do not write to the input", test.desc, name, cap(f.value), len(f.value))
+			}
+			files = append(files, f)
+			before = append(before, string(f.value))
+		}
+		// Files that point into the input see it change.
+		for i := range data {
+			data[i] = 'X'
+		}
+		for i, f := range files {
+			if changed := string(f.value) != before[i]; changed != shared[names[i]] {
+				t.Errorf("TestUnmarshalBytes(%s): %s: got value in input == %v, want %v", test.desc, names[i], changed, shared[names[i]])
+			}
+		}
+		copy(data, text)
+
+		if f, _ := d.GetFile("e"); f.StringOrZV() != "a\nb" {
+			t.Errorf("TestUnmarshalBytes(%s): e: got %q, want %q", test.desc, f.StringOrZV(), "a\nb")
+		}
+		if f, _ := d.GetFile("h"); f.IntOrZV() != 31 {
+			t.Errorf("TestUnmarshalBytes(%s): h: got %d, want 31", test.desc, f.IntOrZV())
+		}
+	}
+
+	if _, err := UnmarshalBytes([]byte(`{"a": "b`)); err == nil {
+		t.Errorf("TestUnmarshalBytes(unterminated string): got err == nil, want err != nil")
+	}
+	if _, err := UnmarshalBytes([]byte(`{"a": "bcd"}`), WithLimits(Limits{MaxStringLen: 2})); err == nil {
+		t.Errorf("TestUnmarshalBytes(MaxStringLen): got err == nil, want err != nil")
+	}
+	if _, err := UnmarshalBytes([]byte("{\"a\": \"b\tc\"}")); err == nil {
+		t.Errorf("TestUnmarshalBytes(control character): got err == nil, want err != nil")
+	}
+}
+
+func TestDeepNesting(t *testing.T) {
+	const depth = 100000
+	text := strings.Repeat(`{"a":[`, depth) + "1" + strings.Repeat("]}", depth)
+
+	d, err := UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("TestDeepNesting: got err == %s, want err == nil", err)
+	}
+	f, err := d.GetFile(strings.Repeat("a/0/", depth-1) + "a/0")
+	if err != nil || f.IntOrZV() != 1 {
+		t.Errorf("TestDeepNesting: got %v, %v, want 1, nil", f.Any(), err)
+	}
+
+	_, err = UnmarshalJSON(strings.NewReader(text[:len(text)-1]))
+	var se *SyntaxError
+	if !errors.As(err, &se) {
+		t.Errorf("TestDeepNesting(truncated): got err == %v, want *SyntaxError", err)
+	}
+}
+
+func TestWhitespace(t *testing.T) {
+	// The bufio.Reader buffer is 4096 bytes, pad must make values cross it.
+	pad := strings.Repeat(" \t\r\n", 1500)
+
+	tests := []struct {
+		desc    string
+		input   string
+		options []DecodeOption
+		want    string
+		err     bool
+	}{
+		{desc: "space across buffers", input: "{" + pad + `"a"` + pad + ":" + pad + "1" + pad + "}", want: `{"a":1}`},
+		{desc: "number across buffers", input: `{"a": ` + strings.Repeat(" ", 4085) + "1234567890.5e3}", want: `{"a":1234567890.5e3}`},
+		{desc: "vertical tab is not JSON space", input: "{\v\"a\": 1}", err: true},
+		{desc: "form feed is not JSON space", input: "{\"a\":\f1}", err: true},
+		{desc: "no-break space is not JSON space", input: "{\u00a0\"a\": 1}", err: true},
+		{desc: "relaxed allows more space", input: "{\v\"a\":\f1\u00a0,\u2028}", options: []DecodeOption{WithRelaxed()}, want: `{"a":1}`},
+		{desc: "relaxed comments", input: "{/* x */\"a\": // y\n 1}", options: []DecodeOption{WithRelaxed()}, want: `{"a":1}`},
+	}
+
+	for _, test := range tests {
+		d, err := UnmarshalJSON(strings.NewReader(test.input), test.options...)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestWhitespace(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestWhitespace(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		buff := &bytes.Buffer{}
+		MarshalJSON(buff, d)
+		if buff.String() != test.want {
+			t.Errorf("TestWhitespace(%s): got %s, want %s", test.desc, buff, test.want)
+		}
+	}
+
+	// Lines are still counted when whitespace is skipped in bulk.
+	_, err := UnmarshalJSON(strings.NewReader("{\n\n  \"a\": 1,\n\n\n  \"b\" 2}"))
+	var se *SyntaxError
+	if !errors.As(err, &se) {
+		t.Fatalf("TestWhitespace(line): got err == %v, want *SyntaxError", err)
+	}
+	if se.Line != 6 || se.Column != 7 {
+		t.Errorf("TestWhitespace(line): got line %d column %d, want line 6 column 7", se.Line, se.Column)
+	}
+
+	// ValueCheck() and SkipSpace() use the same whitespace.
+	b := bufio.NewReaderSize(strings.NewReader(pad+"1"), 16)
+	if next, err := ValueCheck(b); err != nil || next != numNext {
+		t.Errorf("TestWhitespace(ValueCheck): got %v, %v, want numNext, nil", next, err)
+	}
+	for _, input := range []string{"\v1", "\f1", "\u00a01"} {
+		if _, err := ValueCheck(bufio.NewReader(strings.NewReader(input))); err == nil {
+			t.Errorf("TestWhitespace(ValueCheck(%q)): got err == nil, want err != nil", input)
+		}
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		desc   string
+		input  string
+		line   int
+		column int
+		path   string
+	}{
+		{
+			desc:   "bad bool in nested array",
+			input:  "{\n  \"items\": [1, 2, {\"price\": tru}]\n}",
+			line:   2,
+			column: 29,
+			path:   "/items/2/price",
+		},
+		{
+			desc:   "missing colon",
+			input:  "{\"a\": {\"b\" 1}}",
+			line:   1,
+			column: 12,
+			path:   "/a",
+		},
+		{
+			desc:   "key with a slash",
+			input:  `{"a/b": [nul]}`,
+			line:   1,
+			column: 10,
+			path:   "/a~1b/0",
+		},
+		{
+			desc:   "truncated",
+			input:  `{"a": [1, 2`,
+			line:   1,
+			column: 12,
+			path:   "/a",
+		},
+		{
+			desc:   "bad value in array of objects",
+			input:  `{"items":[{"price": 1},{"price": x}]}`,
+			line:   1,
+			column: 34,
+			path:   "/items/1/price",
+		},
+		{
+			desc:   "bad start of a value",
+			input:  `{"a":+1}`,
+			line:   1,
+			column: 6,
+			path:   "/a",
+		},
+		{
+			desc:   "bad array element",
+			input:  `[1, x]`,
+			line:   1,
+			column: 5,
+			path:   "/1",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := UnmarshalJSON(strings.NewReader(test.input))
+		var sErr *SyntaxError
+		if !errors.As(err, &sErr) {
+			t.Errorf("TestSyntaxError(%s): got err == %v, want *SyntaxError", test.desc, err)
+			continue
+		}
+		if sErr.Line != test.line || sErr.Column != test.column || sErr.Path != test.path {
+			t.Errorf("TestSyntaxError(%s): got line %d, column %d, path %q, want line %d, column %d, path %q", test.desc, sErr.Line, sErr.Column, sErr.Path, test.line, test.column, test.path)
+		}
+		if sErr.Offset > int64(len(test.input)) || !strings.Contains(test.input, sErr.Excerpt[:len(sErr.Excerpt)/2]) {
+			t.Errorf("TestSyntaxError(%s): offset %d or excerpt %q do not match the input", test.desc, sErr.Offset, sErr.Excerpt)
+		}
+	}
+
+	// The character in the message is the whole rune, not its first byte.
+	_, err := UnmarshalJSON(strings.NewReader("{\"a\": \u00a01}"))
+	if err == nil || !strings.Contains(err.Error(), `'\u00a0'`) {
+		t.Errorf("TestSyntaxError(no-break space): got err == %v, want it to have %s", err, `'\u00a0'`)
+	}
+}
+
 func TestIsQuote(t *testing.T) {
 	tests := []struct {
 		input string
@@ -243,6 +586,468 @@ func TestIsQuote(t *testing.T) {
 	}
 }
 
+func TestNumberType(t *testing.T) {
+	tests := []struct {
+		input string
+		want  FileType
+		err   bool
+	}{
+		{"0", FTInt, false},
+		{"-0", FTInt, false},
+		{"-3", FTInt, false},
+		{"1234567890", FTInt, false},
+		{"2.5", FTFloat, false},
+		{"-0.5", FTFloat, false},
+		{"1e10", FTFloat, false},
+		{"2.5E-3", FTFloat, false},
+		{"1E+2", FTFloat, false},
+		{"01", 0, true},
+		{"-01", 0, true},
+		{"1.", 0, true},
+		{".5", 0, true},
+		{"-", 0, true},
+		{"+1", 0, true},
+		{"1e", 0, true},
+		{"1e+", 0, true},
+		{"1.5.2", 0, true},
+		{"--1", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := numberType(UnsafeGetBytes(test.input))
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestNumberType(%s): got err == nil, want err != nil", test.input)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestNumberType(%s): got err == %s, want err == nil", test.input, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestNumberType(%s): got %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestUnmarshalNumbers(t *testing.T) {
+	d, err := UnmarshalJSON(strings.NewReader(`{"neg": -3, "exp": 1e3, "frac": 2.5E-3, "arr": [-1,-2.5e1]}`))
+	if err != nil {
+		t.Fatalf("TestUnmarshalNumbers: got err == %s, want err == nil", err)
+	}
+
+	ints := map[string]int64{"neg": -3, "exp": 1000, "arr/0": -1, "arr/1": -25}
+	for p, want := range ints {
+		f, err := d.GetFile(p)
+		if err != nil {
+			t.Fatalf("TestUnmarshalNumbers(%s): %s", p, err)
+		}
+		got, err := f.Int()
+		if err != nil {
+			t.Errorf("TestUnmarshalNumbers(%s): Int() had error: %s", p, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("TestUnmarshalNumbers(%s): got %d, want %d", p, got, want)
+		}
+	}
+
+	f, _ := d.GetFile("frac")
+	if got := f.FloatOrZV(); got != 0.0025 {
+		t.Errorf("TestUnmarshalNumbers(frac): got %v, want 0.0025", got)
+	}
+
+	// column is where the error is found.
+	bad := []struct {
+		input  string
+		column int
+	}{
+		{`{"a": 01}`, 8},
+		{`{"a": 1.}`, 9},
+		{`{"a": -}`, 8},
+		{`{"a": 1e}`, 9},
+		{`{"a": 1.e5}`, 9},
+		{`{"a": 1.5.3}`, 10},
+		{`{"a": -x}`, 8},
+	}
+	for _, test := range bad {
+		_, err := UnmarshalJSON(strings.NewReader(test.input))
+		var sErr *SyntaxError
+		if !errors.As(err, &sErr) {
+			t.Errorf("TestUnmarshalNumbers(%s): got err == %v, want *SyntaxError", test.input, err)
+			continue
+		}
+		if sErr.Column != test.column || sErr.Offset != int64(test.column-1) {
+			t.Errorf("TestUnmarshalNumbers(%s): got column %d, offset %d, want column %d, offset %d", test.input, sErr.Column, sErr.Offset, test.column, test.column-1)
+		}
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	const text = `{"id":123456789012345678901234567890,"shortest":0.30000000000000004,"money":12345678901234567.89,"small":1.5,"max":9223372036854775807}`
+
+	d, err := UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("TestBigNumbers: got err == %s, want err == nil", err)
+	}
+
+	types := map[string]FileType{
+		"id":       FTBigInt,
+		"shortest": FTFloat,
+		"money":    FTDecimal,
+		"small":    FTFloat,
+		"max":      FTInt,
+	}
+	for name, want := range types {
+		f, err := d.GetFile(name)
+		if err != nil {
+			t.Fatalf("TestBigNumbers(%s): %s", name, err)
+		}
+		if f.JSONType() != want {
+			t.Errorf("TestBigNumbers(%s): got type %v, want %v", name, f.JSONType(), want)
+		}
+	}
+
+	f, _ := d.GetFile("id")
+	i, err := f.BigInt()
+	if err != nil {
+		t.Fatalf("TestBigNumbers(id): BigInt() had error: %s", err)
+	}
+	if i.String() != "123456789012345678901234567890" {
+		t.Errorf("TestBigNumbers(id): got %s, want 123456789012345678901234567890", i)
+	}
+
+	f, _ = d.GetFile("money")
+	n, err := f.Number()
+	if err != nil {
+		t.Fatalf("TestBigNumbers(money): Number() had error: %s", err)
+	}
+	if n != "12345678901234567.89" {
+		t.Errorf("TestBigNumbers(money): got %s, want 12345678901234567.89", n)
+	}
+	bf, err := f.BigFloat()
+	if err != nil {
+		t.Fatalf("TestBigNumbers(money): BigFloat() had error: %s", err)
+	}
+	if bf.Text('f', 2) != "12345678901234567.89" {
+		t.Errorf("TestBigNumbers(money): BigFloat() got %s, want 12345678901234567.89", bf.Text('f', 2))
+	}
+
+	buff := &bytes.Buffer{}
+	if err := MarshalJSON(buff, d); err != nil {
+		t.Fatalf("TestBigNumbers: MarshalJSON had error: %s", err)
+	}
+	for _, want := range []string{`"id":123456789012345678901234567890`, `"money":12345678901234567.89`, `"shortest":0.30000000000000004`} {
+		if !strings.Contains(buff.String(), want) {
+			t.Errorf("TestBigNumbers: MarshalJSON output %s did not contain %s", buff.String(), want)
+		}
+	}
+
+	buff.Reset()
+	nf := MustNewFile("id", big.NewInt(0).Lsh(big.NewInt(1), 100))
+	if err := nf.EncodeJSON(buff); err != nil {
+		t.Fatalf("TestBigNumbers: EncodeJSON had error: %s", err)
+	}
+	if buff.String() != "1267650600228229401496703205376" || nf.JSONType() != FTBigInt {
+		t.Errorf("TestBigNumbers: NewFile(*big.Int): got %s(%v), want 1267650600228229401496703205376(FTBigInt)", buff.String(), nf.JSONType())
+	}
+
+	if _, err := NewFile("bad", json.Number("01")); err == nil {
+		t.Errorf("TestBigNumbers: NewFile(json.Number(01)): got err == nil, want err != nil")
+	}
+
+	// A float keeps its FileType when it is marshaled and unmarshaled.
+	for _, v := range []any{1e21, -1e-7, 2.0, 0.1, 1e300, float32(1e21), float32(0.1)} {
+		f := MustNewFile("", v)
+		buff.Reset()
+		if err := f.EncodeJSON(buff); err != nil {
+			t.Fatalf("TestBigNumbers: EncodeJSON(%v) had error: %s", v, err)
+		}
+		got, err := UnmarshalValue(buff)
+		if err != nil {
+			t.Errorf("TestBigNumbers: UnmarshalValue(%s) had error: %s", buff, err)
+			continue
+		}
+		if got.(File).JSONType() != f.JSONType() {
+			t.Errorf("TestBigNumbers: NewFile(%v) was %v, got %v after a round trip of %s", v, f.JSONType(), got.(File).JSONType(), buff)
+		}
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	const text = "[{\"a\": 1,\n \"a\": {\"b\": 2}, \"a\": [3]}]"
+
+	tests := []struct {
+		desc   string
+		policy DuplicatePolicy
+		want   string
+		err    bool
+	}{
+		{desc: "error", policy: DuplicateError, err: true},
+		{desc: "first wins", policy: DuplicateFirstWins, want: `[{"a":1}]`},
+		{desc: "last wins", policy: DuplicateLastWins, want: `[{"a":[3]}]`},
+		{desc: "collect", policy: DuplicateCollect, want: `[{"a":[1,{"b":2},[3]]}]`},
+	}
+
+	for _, test := range tests {
+		var dups []Duplicate
+		d, err := UnmarshalJSON(
+			strings.NewReader(text),
+			WithDuplicates(test.policy),
+			WithDuplicateReport(func(dup Duplicate) { dups = append(dups, dup) }),
+		)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestDuplicates(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestDuplicates(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			var sErr *SyntaxError
+			if !errors.As(err, &sErr) || sErr.Path != "/0/a" {
+				t.Errorf("TestDuplicates(%s): got err == %v, want *SyntaxError with Path /0/a", test.desc, err)
+			}
+			continue
+		}
+
+		buff := &bytes.Buffer{}
+		if err := MarshalJSON(buff, d); err != nil {
+			t.Fatalf("TestDuplicates(%s): MarshalJSON had error: %s", test.desc, err)
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestDuplicates(%s): got %s, want %s", test.desc, buff.String(), test.want)
+		}
+
+		want := []Duplicate{
+			{Key: "a", Path: "/0/a", Offset: 11, Line: 2, Column: 2},
+			{Key: "a", Path: "/0/a", Offset: 26, Line: 2, Column: 17},
+		}
+		if diff := pretty.Compare(want, dups); diff != "" {
+			t.Errorf("TestDuplicates(%s): duplicate report: -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	longString := `"` + strings.Repeat("x", 100000) + `"`
+
+	tests := []struct {
+		desc   string
+		input  string
+		limits Limits
+		// limit is the Limit in the LimitError we want, empty if we want no error.
+		limit string
+		path  string
+	}{
+		{desc: "depth ok", input: `{"a": [{"b": 1}]}`, limits: Limits{MaxDepth: 3}},
+		{desc: "depth exceeded", input: `{"a": [{"b": 1}]}`, limits: Limits{MaxDepth: 2}, limit: "MaxDepth", path: "/a/0"},
+		{desc: "very deep", input: strings.Repeat("[", 100000), limits: Limits{MaxDepth: 100}, limit: "MaxDepth", path: strings.Repeat("/0", 100)},
+		{desc: "bytes ok", input: ` {"a": [1, 2]} `, limits: Limits{MaxBytes: 13}},
+		{desc: "bytes exceeded", input: `{"a": [1, 2]}`, limits: Limits{MaxBytes: 12}, limit: "MaxBytes", path: ""},
+		{desc: "bytes exceeded in number", input: `123456`, limits: Limits{MaxBytes: 5}, limit: "MaxBytes", path: ""},
+		{desc: "string ok", input: `{"abc": "hello"}`, limits: Limits{MaxStringLen: 5}},
+		{desc: "string exceeded", input: `{"abc": "hello"}`, limits: Limits{MaxStringLen: 4}, limit: "MaxStringLen", path: "/abc"},
+		{desc: "key exceeded", input: `{"abc": "hello"}`, limits: Limits{MaxStringLen: 2}, limit: "MaxStringLen", path: ""},
+		{desc: "long string", input: longString},
+		{desc: "long string exceeded", input: longString, limits: Limits{MaxStringLen: 10}, limit: "MaxStringLen", path: ""},
+		{desc: "keys ok", input: `{"a": 1, "b": 2, "a": 3}`, limits: Limits{MaxKeys: 2}},
+		{desc: "keys exceeded", input: `{"a": 1, "b": 2}`, limits: Limits{MaxKeys: 1}, limit: "MaxKeys", path: "/b"},
+		{desc: "array ok", input: `[1, 2, 3]`, limits: Limits{MaxArrayLen: 3}},
+		{desc: "array exceeded", input: `[1, 2, 3]`, limits: Limits{MaxArrayLen: 2}, limit: "MaxArrayLen", path: "/2"},
+	}
+
+	for _, test := range tests {
+		v, err := UnmarshalValue(strings.NewReader(test.input), WithLimits(test.limits), WithDuplicates(DuplicateLastWins))
+		if test.limit == "" {
+			if err != nil {
+				t.Errorf("TestLimits(%s): got err == %s, want err == nil", test.desc, err)
+			}
+			if test.input == longString {
+				if s := v.(File).StringOrZV(); len(s) != 100000 {
+					t.Errorf("TestLimits(%s): got string of length %d, want 100000", test.desc, len(s))
+				}
+			}
+			continue
+		}
+
+		var lErr *LimitError
+		if !errors.As(err, &lErr) {
+			t.Errorf("TestLimits(%s): got err == %v, want *LimitError", test.desc, err)
+			continue
+		}
+		if lErr.Limit != test.limit || lErr.Path != test.path {
+			t.Errorf("TestLimits(%s): got LimitError(%s at %q), want LimitError(%s at %q)", test.desc, lErr.Limit, lErr.Path, test.limit, test.path)
+		}
+	}
+
+	// MaxBytes applies to each value in a stream, not the whole stream.
+	got, err := streamOutput(UnmarshalStream(context.Background(), strings.NewReader("{\"a\":1}\n{\"a\":2}\n"), WithLimits(Limits{MaxBytes: 7})))
+	if err != nil || len(got) != 2 {
+		t.Errorf("TestLimits(stream): got %v, %v, want 2 values and err == nil", got, err)
+	}
+}
+
+func TestRelaxed(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{desc: "line comments", input: "// config\n{\"a\": 1 // one\n}", want: `{"a":1}`},
+		{desc: "block comments", input: "/* a */ [1, /* two */ 2] /* end */", want: `[1,2]`},
+		{desc: "comment in empty object", input: "{ /* nothing */ }", want: `{}`},
+		{desc: "trailing comma in object", input: `{"a": [1, 2,],}`, want: `{"a":[1,2]}`},
+		{desc: "trailing comma in array", input: `[[], {}, ]`, want: `[[],{}]`},
+		{desc: "single quotes", input: `{'a': 'it\'s "quoted"'}`, want: `{"a":"it's \"quoted\""}`},
+		{desc: "unquoted keys", input: `{$id_1: 1}`, want: `{"$id_1":1}`},
+		{desc: "hex numbers", input: `[0x1F, -0xff, 0xFFFFFFFFFFFFFFFFFF]`, want: `[31,-255,4722366482869645213695]`},
+	}
+
+	for _, test := range tests {
+		if _, err := UnmarshalValue(strings.NewReader(test.input)); err == nil {
+			t.Errorf("TestRelaxed(%s): strict mode: got err == nil, want err != nil", test.desc)
+		}
+
+		v, err := UnmarshalValue(strings.NewReader(test.input), WithRelaxed())
+		if err != nil {
+			t.Errorf("TestRelaxed(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		buff := &bytes.Buffer{}
+		if err := MarshalJSON(buff, v); err != nil {
+			t.Fatalf("TestRelaxed(%s): MarshalJSON had error: %s", test.desc, err)
+		}
+		if buff.String() != test.want {
+			t.Errorf("TestRelaxed(%s): got %s, want %s", test.desc, buff.String(), test.want)
+		}
+	}
+
+	// Whitespace in an empty object or array is valid JSON.
+	if _, err := UnmarshalJSON(strings.NewReader(`{"a": [ ], "b": { }}`)); err != nil {
+		t.Errorf("TestRelaxed(empty with whitespace): got err == %s, want err == nil", err)
+	}
+
+	bad := []string{`{'a": 1}`, `{1a: 1}`, `[0x]`, `[0xG]`, `[1 / 2]`, `{"a":1} /* oops`, `[1, /* 2]`, `/* {}`}
+	for _, input := range bad {
+		if _, err := UnmarshalValue(strings.NewReader(input), WithRelaxed()); err == nil {
+			t.Errorf("TestRelaxed(%s): got err == nil, want err != nil", input)
+		}
+	}
+	if _, err := UnmarshalValue(strings.NewReader(`["\'"]`), WithRelaxed()); err != nil {
+		t.Errorf(`TestRelaxed(["\'"]): got err == %s, want err == nil`, err)
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	const text = `[Infinity, -Infinity, NaN, -1]`
+
+	if _, err := UnmarshalJSON(strings.NewReader(text)); err == nil {
+		t.Errorf("TestNonFinite: without WithNonFinite(): got err == nil, want err != nil")
+	}
+
+	d, err := UnmarshalJSON(strings.NewReader(text), WithNonFinite())
+	if err != nil {
+		t.Fatalf("TestNonFinite: got err == %s, want err == nil", err)
+	}
+	want := []float64{math.Inf(1), math.Inf(-1), math.NaN(), -1}
+	for i, w := range want {
+		f, err := d.GetFile(strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("TestNonFinite(%d): %s", i, err)
+		}
+		got, err := f.Float()
+		if err != nil {
+			t.Errorf("TestNonFinite(%d): Float() had error: %s", i, err)
+			continue
+		}
+		if got != w && !(math.IsNaN(got) && math.IsNaN(w)) {
+			t.Errorf("TestNonFinite(%d): got %v, want %v", i, got, w)
+		}
+	}
+
+	if err := MarshalJSON(&bytes.Buffer{}, d); err == nil {
+		t.Errorf("TestNonFinite: MarshalJSON: got err == nil, want err != nil")
+	}
+}
+
+func TestKeyOrder(t *testing.T) {
+	const text = `{"zebra":1,"apple":{"y":true,"b":null,"m":[{"z":1,"a":2}]},"mango":"x"}`
+
+	d, err := UnmarshalJSON(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("TestKeyOrder: got err == %s, want err == nil", err)
+	}
+
+	buff := &bytes.Buffer{}
+	if err := MarshalJSON(buff, d); err != nil {
+		t.Fatalf("TestKeyOrder: MarshalJSON had error: %s", err)
+	}
+	if buff.String() != text {
+		t.Errorf("TestKeyOrder: MarshalJSON: got %s, want %s", buff.String(), text)
+	}
+
+	des, err := d.ReadDirInOrder(-1)
+	if err != nil {
+		t.Fatalf("TestKeyOrder: ReadDirInOrder had error: %s", err)
+	}
+	if diff := pretty.Compare([]string{"zebra", "apple", "mango"}, dirEntryToNames(des)); diff != "" {
+		t.Errorf("TestKeyOrder: ReadDirInOrder: -want/+got:\n%s", diff)
+	}
+	des, _ = d.ReadDirInOrder(2)
+	if diff := pretty.Compare([]string{"zebra", "apple"}, dirEntryToNames(des)); diff != "" {
+		t.Errorf("TestKeyOrder: ReadDirInOrder(2): -want/+got:\n%s", diff)
+	}
+	des, _ = d.ReadDir(-1)
+	if diff := pretty.Compare([]string{"apple", "mango", "zebra"}, dirEntryToNames(des)); diff != "" {
+		t.Errorf("TestKeyOrder: ReadDir: -want/+got:\n%s", diff)
+	}
+
+	// Changing a copy does not change the original.
+	c := CP(d)
+	if err := c.Set(MustNewFile("banana", 3)); err != nil {
+		t.Fatalf("TestKeyOrder: Set on CP() had error: %s", err)
+	}
+	if err := c.Remove("zebra"); err != nil {
+		t.Fatalf("TestKeyOrder: Remove on CP() had error: %s", err)
+	}
+	apple, _ := c.GetDir("apple")
+	if err := apple.Remove("y"); err != nil {
+		t.Fatalf("TestKeyOrder: Remove on CP() of apple had error: %s", err)
+	}
+	des, _ = d.ReadDirInOrder(-1)
+	if diff := pretty.Compare([]string{"zebra", "apple", "mango"}, dirEntryToNames(des)); diff != "" {
+		t.Errorf("TestKeyOrder: ReadDirInOrder after changing CP(): -want/+got:\n%s", diff)
+	}
+	buff.Reset()
+	if err := MarshalJSON(buff, d); err != nil {
+		t.Fatalf("TestKeyOrder: MarshalJSON had error: %s", err)
+	}
+	if buff.String() != text {
+		t.Errorf("TestKeyOrder: after changing CP(): got %s, want %s", buff.String(), text)
+	}
+
+	// Replacing a key keeps its place, a new key goes at the end and a removed
+	// key that is added back goes at the end.
+	if err := d.Set(MustNewFile("apple", 2), MustNewFile("banana", 3)); err != nil {
+		t.Fatalf("TestKeyOrder: Set had error: %s", err)
+	}
+	if err := d.Remove("zebra"); err != nil {
+		t.Fatalf("TestKeyOrder: Remove had error: %s", err)
+	}
+	if err := d.WriteFile("zebra", []byte("4")); err != nil {
+		t.Fatalf("TestKeyOrder: WriteFile had error: %s", err)
+	}
+	buff.Reset()
+	if err := MarshalJSON(buff, d); err != nil {
+		t.Fatalf("TestKeyOrder: MarshalJSON had error: %s", err)
+	}
+	if want := `{"apple":2,"mango":"x","banana":3,"zebra":4}`; buff.String() != want {
+		t.Errorf("TestKeyOrder: after changes: got %s, want %s", buff.String(), want)
+	}
+}
+
 func BenchmarkUnmarshalSmall(b *testing.B) {
 	r := strings.NewReader(jsonText)
 	b.ReportAllocs()
@@ -276,6 +1081,19 @@ func BenchmarkUnmarshalLarge(b *testing.B) {
 	}
 }
 
+func BenchmarkUnmarshalBytesLarge(b *testing.B) {
+	data := []byte(largeJSON)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := UnmarshalBytes(data)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func BenchmarkStandardUnmarshalSmall(b *testing.B) {
 	r := strings.NewReader(jsonText)
 	b.ReportAllocs()
@@ -0,0 +1,160 @@
+package jsonfs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// SkipSubtree is returned by a Handler method to skip an object or array.
+// Returned by OnObjectStart() or OnArrayStart(), the object or array is
+// skipped. Returned by OnValue(), the rest of the object or array holding the
+// value is skipped. The end method for a skipped object or array is not called.
+var SkipSubtree = errors.New("skip this subtree")
+
+// Stop is returned by a Handler method to stop Walk(), which returns nil.
+var Stop = errors.New("stop walking")
+
+// Handler has the methods Walk() calls. path is the path to the object, array
+// or value, like the paths used with Directory.GetFile() and in an FS, such
+// as "users/0/email". The path of a top level value is ".". Any error other
+// than SkipSubtree or Stop stops Walk(), which returns it.
+type Handler interface {
+	// OnObjectStart is called at the start of an object.
+	OnObjectStart(path string) error
+	// OnObjectEnd is called at the end of an object.
+	OnObjectEnd(path string) error
+	// OnArrayStart is called at the start of an array.
+	OnArrayStart(path string) error
+	// OnArrayEnd is called at the end of an array.
+	OnArrayEnd(path string) error
+	// OnValue is called for a value that is not an object or array. f is
+	// named for the last part of path.
+	OnValue(path string, f File) error
+}
+
+// HandlerFuncs is a Handler made of functions. Nil functions are not called.
+type HandlerFuncs struct {
+	ObjectStart func(path string) error
+	ObjectEnd   func(path string) error
+	ArrayStart  func(path string) error
+	ArrayEnd    func(path string) error
+	Value       func(path string, f File) error
+}
+
+// OnObjectStart implements Handler.OnObjectStart().
+func (h HandlerFuncs) OnObjectStart(path string) error {
+	if h.ObjectStart == nil {
+		return nil
+	}
+	return h.ObjectStart(path)
+}
+
+// OnObjectEnd implements Handler.OnObjectEnd().
+func (h HandlerFuncs) OnObjectEnd(path string) error {
+	if h.ObjectEnd == nil {
+		return nil
+	}
+	return h.ObjectEnd(path)
+}
+
+// OnArrayStart implements Handler.OnArrayStart().
+func (h HandlerFuncs) OnArrayStart(path string) error {
+	if h.ArrayStart == nil {
+		return nil
+	}
+	return h.ArrayStart(path)
+}
+
+// OnArrayEnd implements Handler.OnArrayEnd().
+func (h HandlerFuncs) OnArrayEnd(path string) error {
+	if h.ArrayEnd == nil {
+		return nil
+	}
+	return h.ArrayEnd(path)
+}
+
+// OnValue implements Handler.OnValue().
+func (h HandlerFuncs) OnValue(path string, f File) error {
+	if h.Value == nil {
+		return nil
+	}
+	return h.Value(path, f)
+}
+
+// Walk reads the JSON in r and calls the methods of h for each object, array
+// and value in it, in the order they are in the input. This does not build a
+// Directory, so memory use only depends on the nesting depth and the size of
+// the largest value. This is like fs.WalkDir() on an FS holding the JSON, but
+// you can skip parts of the input with SkipSubtree.
+//
+// r may hold many JSON values, such as NDJSON, which are walked one after the
+// other. Options work as they do with NewScanner(). If the input is not valid
+// JSON, a *SyntaxError is returned, after h has been called for the values
+// before the error.
+func Walk(r io.Reader, h Handler, options ...DecodeOption) error {
+	b := bufioReader(r)
+	defer putReader(b, r)
+
+	d := newDecoder(b, newDecodeOptions(options))
+	defer d.close()
+
+	s := newScanner(d)
+	modTime := time.Now()
+	for {
+		tok, err := s.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		switch tok.Kind {
+		case TokenKey:
+			continue
+		case TokenBeginObject:
+			err = h.OnObjectStart(walkPath(d.path))
+		case TokenEndObject:
+			err = h.OnObjectEnd(walkPath(d.path))
+		case TokenBeginArray:
+			err = h.OnArrayStart(walkPath(d.path))
+		case TokenEndArray:
+			err = h.OnArrayEnd(walkPath(d.path))
+		default:
+			var name string
+			if len(d.path) > 0 {
+				name = d.path[len(d.path)-1]
+			}
+			value := tok.Value
+			if tok.Kind == TokenString {
+				value = append([]byte(nil), value...) // The Scanner reuses string buffers.
+			}
+			err = h.OnValue(walkPath(d.path), File{name: name, modTime: modTime, t: tok.Type, value: value})
+		}
+
+		switch err {
+		case nil:
+		case Stop:
+			return nil
+		case SkipSubtree:
+			if tok.Kind == TokenEndObject || tok.Kind == TokenEndArray {
+				continue
+			}
+			if err := s.Skip(); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// walkPath joins the parts of a decoder path into a path for a Handler.
+func walkPath(parts []string) string {
+	if len(parts) == 0 {
+		return "."
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,208 @@
+package jsonfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// recorder is a Handler that records its calls. If a path is in skip or stop,
+// SkipSubtree or Stop is returned for it.
+type recorder struct {
+	calls      []string
+	skip, stop map[string]bool
+}
+
+func (r *recorder) record(call, path string) error {
+	r.calls = append(r.calls, call+" "+path)
+	switch {
+	case r.skip[call+" "+path]:
+		return SkipSubtree
+	case r.stop[call+" "+path]:
+		return Stop
+	}
+	return nil
+}
+
+func (r *recorder) OnObjectStart(path string) error { return r.record("{", path) }
+func (r *recorder) OnObjectEnd(path string) error   { return r.record("}", path) }
+func (r *recorder) OnArrayStart(path string) error  { return r.record("[", path) }
+func (r *recorder) OnArrayEnd(path string) error    { return r.record("]", path) }
+func (r *recorder) OnValue(path string, f File) error {
+	return r.record(fmt.Sprintf("%s=%v(%s)", f.Name(), f.Any(), f.JSONType()), path)
+}
+
+func TestWalk(t *testing.T) {
+	const input = `{"a": {"b": [1, "x"], "c": true}, "d": null}`
+
+	tests := []struct {
+		desc  string
+		input string
+		skip  []string
+		stop  []string
+		want  []string
+		err   bool
+	}{
+		{
+			desc:  "everything",
+			input: input,
+			want: []string{
+				"{ .",
+				"{ a",
+				"[ a/b",
+				"0=1(FTInt) a/b/0",
+				"1=x(FTString) a/b/1",
+				"] a/b",
+				"c=true(FTBool) a/c",
+				"} a",
+				"d=<nil>(FTNull) d",
+				"} .",
+			},
+		},
+		{
+			desc:  "skip an object",
+			input: input,
+			skip:  []string{"{ a"},
+			want: []string{
+				"{ .",
+				"{ a",
+				"d=<nil>(FTNull) d",
+				"} .",
+			},
+		},
+		{
+			desc:  "skip the rest of an array from a value",
+			input: input,
+			skip:  []string{"0=1(FTInt) a/b/0"},
+			want: []string{
+				"{ .",
+				"{ a",
+				"[ a/b",
+				"0=1(FTInt) a/b/0",
+				"c=true(FTBool) a/c",
+				"} a",
+				"d=<nil>(FTNull) d",
+				"} .",
+			},
+		},
+		{
+			desc:  "stop",
+			input: input,
+			stop:  []string{"[ a/b"},
+			want: []string{
+				"{ .",
+				"{ a",
+				"[ a/b",
+			},
+		},
+		{
+			desc:  "many values",
+			input: "{\"a\": 1}\n2\n",
+			want: []string{
+				"{ .",
+				"a=1(FTInt) a",
+				"} .",
+				"=2(FTInt) .",
+			},
+		},
+		{
+			desc:  "skipped values are still checked",
+			input: `{"a": [1, 2 3], "b": 1}`,
+			skip:  []string{"[ a"},
+			want: []string{
+				"{ .",
+				"[ a",
+			},
+			err: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := &recorder{skip: map[string]bool{}, stop: map[string]bool{}}
+		for _, s := range test.skip {
+			r.skip[s] = true
+		}
+		for _, s := range test.stop {
+			r.stop[s] = true
+		}
+
+		err := Walk(strings.NewReader(test.input), r)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestWalk(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestWalk(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(test.want, r.calls); diff != "" {
+			t.Errorf("TestWalk(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+
+	myErr := errors.New("my error")
+	err := Walk(strings.NewReader(input), HandlerFuncs{Value: func(string, File) error { return myErr }})
+	if err != myErr {
+		t.Errorf("TestWalk(handler error): got err == %v, want %v", err, myErr)
+	}
+}
+
+// TestWalkLikeWalkDir tests that Walk() gives the same output as fs.WalkDir()
+// on a MemFS holding the same JSON, as in examples/dirwalk.
+func TestWalkLikeWalkDir(t *testing.T) {
+	dir, err := UnmarshalJSON(strings.NewReader(jsonText))
+	if err != nil {
+		t.Fatalf("TestWalkLikeWalkDir: UnmarshalJSON had error: %s", err)
+	}
+
+	var want []string
+	err = fs.WalkDir(NewMemFS(dir), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		p = path.Clean(p)
+		switch x := d.(type) {
+		case File:
+			want = append(want, fmt.Sprintf("%s:%s:%v", p, x.JSONType(), x.Any()))
+		case Directory:
+			want = append(want, fmt.Sprintf("%s/", p))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TestWalkLikeWalkDir: fs.WalkDir had error: %s", err)
+	}
+
+	var got []string
+	dirFunc := func(p string) error {
+		if p == "." { // fs.WalkDir() does not give a Directory for the root.
+			return nil
+		}
+		got = append(got, fmt.Sprintf("%s/", p))
+		return nil
+	}
+	err = Walk(strings.NewReader(jsonText), HandlerFuncs{
+		ObjectStart: dirFunc,
+		ArrayStart:  dirFunc,
+		Value: func(p string, f File) error {
+			got = append(got, fmt.Sprintf("%s:%s:%v", p, f.JSONType(), f.Any()))
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestWalkLikeWalkDir: Walk had error: %s", err)
+	}
+
+	// fs.WalkDir() goes in name order, Walk() in input order.
+	sort.Strings(want)
+	sort.Strings(got)
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestWalkLikeWalkDir: -want/+got:\n%s", diff)
+	}
+}